@@ -14,21 +14,68 @@ import (
 )
 
 const (
-	EnvErrorFmt                            = "Error creating config from env: %s"
-	DefaultNginxTemplatePath               = "/etc/nginx/nginx.template"
-	DefaultNginxConfPath                   = "/etc/nginx/nginx.conf"
-	MarathonScheduler        SchedulerType = 1
-	SwarmScheduler           SchedulerType = 2
+	EnvErrorFmt                                = "Error creating config from env: %s"
+	DefaultNginxTemplatePath                   = "/etc/nginx/nginx.template"
+	DefaultNginxConfPath                       = "/etc/nginx/nginx.conf"
+	DefaultNginxPidFile                        = "/var/run/nginx.pid"
+	DefaultHAProxyTemplatePath                 = "/etc/haproxy/haproxy.template"
+	DefaultAppTemplatesDir                     = "/etc/nginx/templates.d"
+	DefaultAppSnippetsDir                      = "/etc/nginx/apps.d"
+	DefaultAppTemplate                         = "default"
+	DefaultAutoListenPort                      = 80
+	DefaultAutoTLSListenPort                   = 443
+	HandlebarsEngine                           = "handlebars"
+	GoTemplateEngine                           = "go"
+	DefaultCoalesceQuietPeriodMs               = 500
+	DefaultCoalesceMaxDelayMs                  = 5000
+	DefaultCoalesceMinIntervalMs               = 2000
+	DefaultHistorySize                         = 500
+	DefaultHAProxyConfPath                     = "/etc/haproxy/haproxy.cfg"
+	DefaultHAProxyPidFile                      = "/var/run/haproxy.pid"
+	NginxDriver                                = "nginx"
+	HAProxyDriver                              = "haproxy"
+	UpstreamAPINginxPlus                       = "nginx-plus"
+	UpstreamAPIDyups                           = "dyups"
+	DefaultXdsPort                             = 18000
+	DefaultXdsListenerPort                     = 10000
+	DefaultXdsConnectTimeoutMs                 = 5000
+	DefaultKubernetesEndpoint                  = "https://kubernetes.default.svc"
+	DefaultConsulEndpoint                      = "http://127.0.0.1:8500"
+	MarathonScheduler            SchedulerType = 1
+	SwarmScheduler               SchedulerType = 2
+	KubernetesScheduler          SchedulerType = 3
+	ConsulScheduler              SchedulerType = 4
+	FileScheduler                SchedulerType = 5
+	CompositeScheduler           SchedulerType = 6
 )
 
 type SchedulerType int
 
+func (t SchedulerType) String() string {
+	switch t {
+	case MarathonScheduler:
+		return "marathon"
+	case SwarmScheduler:
+		return "swarm"
+	case KubernetesScheduler:
+		return "kubernetes"
+	case ConsulScheduler:
+		return "consul"
+	case FileScheduler:
+		return "file"
+	case CompositeScheduler:
+		return "composite"
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
 var log = logger.GetLogger("beethoven.config")
 
 // Config provides configuration information for Marathon streams and the proxy
 type Config struct {
-	// Scheduler type to use (0 for Marathon, 1 for Swarm)
-	// Only applicable if both Swarm and Marathon are configured
+	// Scheduler type to use (1 for Marathon, 2 for Swarm, 3 for Kubernetes, 4 for Consul, 5 for File,
+	// 6 for Composite)
+	// Only applicable if more than one scheduler is configured
 	SchedulerType SchedulerType `json:"scheduler_type"`
 
 	// Docker/Swarm configuration
@@ -37,6 +84,18 @@ type Config struct {
 	// Marathon configuration options
 	Marathon *MarathonConfig `json:"marathon"`
 
+	// Kubernetes configuration options
+	Kubernetes *KubernetesConfig `json:"kubernetes"`
+
+	// Consul catalog configuration options
+	Consul *ConsulConfig `json:"consul"`
+
+	// Static file configuration options
+	File *FileConfig `json:"file"`
+
+	// Composite configuration options - runs multiple schedulers together
+	Composite *CompositeConfig `json:"composite"`
+
 	// Deprecated - Please use Marathon
 	MarthonUrls []string `json:"marthon_urls" envconfig:"-"`
 
@@ -61,11 +120,45 @@ type Config struct {
 	Scheme string `json:"scheme"`
 
 	// Location to nginx.conf template - default: /etc/nginx/nginx.template
+	// (/etc/haproxy/haproxy.template when using the haproxy driver)
 	Template string `json:"template"`
 
+	// Engine templates are written for (handlebars | go).  The go engine uses text/template
+	// with a sprig like function library.  Default: handlebars
+	TemplateEngine string `json:"template_engine"`
+
 	// Location of the nginx.conf - default: /etc/nginx/nginx.conf
 	NginxConfig string `json:"nginx_config"`
 
+	// Multiple templates rendered to their own output files.  If set, Template is ignored.
+	// All outputs are validated together through the proxy config (which should include the
+	// others) and the proxy is reloaded once
+	Templates []*TemplateConfig `json:"templates"`
+
+	// Per app snippets.  Each app selects a template by name with the BT_TEMPLATE label and
+	// is rendered to its own file, which the main template includes
+	AppTemplates *AppTemplatesConfig `json:"app_templates"`
+
+	// Generates nginx upstreams and routes from app labels (BT_VHOST, BT_PATH, BT_PORT_INDEX,
+	// BT_TLS, BT_STRIP_PREFIX) so apps can be routed without writing a template
+	Auto *AutoConfig `json:"auto"`
+
+	// Proxy driver configuration - defaults to Nginx
+	Proxy *ProxyConfig `json:"proxy"`
+
+	// Number of events (syncs, renders, reloads, errors, etc) kept for /bt/history.  Default: 500
+	HistorySize int `json:"history_size"`
+
+	// Coalescing of scheduler events into config renders and proxy reloads
+	Coalesce *CoalesceConfig `json:"coalesce"`
+
+	// Conditions /bt/ready checks before reporting Beethoven as ready
+	Readiness *ReadinessConfig `json:"readiness"`
+
+	// Envoy control plane configuration.  If set, Beethoven serves xDS to Envoy instead of
+	// rendering a template and reloading a proxy
+	Xds *XdsConfig `json:"xds"`
+
 	// User defined configuration data that can be used as part of the template parsing
 	// if Beethoven is launched with --root-apps=false .
 	Data map[string]interface{}
@@ -87,7 +180,15 @@ type SwarmConfig struct {
 	// can be used in scenarios where Beethoven is running outside of the Swarm cluster
 	RouteToNode bool
 
-	// Interval to watch for Swarm topology changes
+	// TaskEndpoints will emit one task per healthy running replica, addressed by the replica's
+	// container IP on Network, instead of a single task for the service VIP.  This allows Nginx
+	// to do its own balancing, sticky sessions and passive health checks.  Container health checks
+	// are only visible for replicas on the node of Endpoint, others are healthy while running.
+	// Ignored if RouteToNode is set
+	TaskEndpoints bool `json:"task_endpoints"`
+
+	// Interval to poll for Swarm topology changes.  Polling is only used while the Docker
+	// event stream is unavailable
 	WatchIntervalSecs int `json:"watch_interval_secs"`
 
 	// TLS Certificate file
@@ -116,6 +217,228 @@ type MarathonConfig struct {
 	// The basic auth password - if applicable
 	// Enivronment variable: BT_PASSWORD
 	Password string `json:"password" envconfig:"password"`
+
+	// Interval to health check all endpoints and elect the active (leading) Marathon
+	// master.  Default: 10 seconds
+	HealthCheckIntervalSecs int `json:"health_check_interval_secs"`
+
+	// Maximum delay between attempts to reconnect a dropped event stream.  Reconnects
+	// use an exponential backoff with jitter starting at 1 second.  Default: 60 seconds
+	MaxReconnectDelaySecs int `json:"max_reconnect_delay_secs"`
+}
+
+type KubernetesConfig struct {
+	// The URL to the Kubernetes API server.  Default: https://kubernetes.default.svc (in-cluster)
+	Endpoint string `json:"endpoint"`
+
+	// Namespace to watch Services/Endpoints in.  Empty watches all namespaces
+	Namespace string `json:"namespace"`
+
+	// Optional label selector to limit the Services proxied. ex. expose=true
+	LabelSelector string `json:"label_selector"`
+
+	// Bearer token used to authenticate with the API server.  If neither Token or TokenFile
+	// are set the in-cluster service account token is used when present
+	Token string `json:"token"`
+
+	// File containing the bearer token - re-read on every request to support token rotation
+	TokenFile string `json:"token_file"`
+
+	// CA certificate to verify the API server.  Defaults to the in-cluster service account CA
+	CACert string `json:"ca_cert"`
+
+	// Skip verification of the API server certificate
+	Insecure bool `json:"insecure"`
+
+	// Namespace Beethoven itself is running in (used to find other Beethoven instances)
+	PodNamespace string `json:"pod_namespace"`
+
+	// Label selector matching Beethoven's own pods. ex. app=beethoven.  If set,
+	// will allow for reloading all instances
+	PodSelector string `json:"pod_selector"`
+}
+
+type ConsulConfig struct {
+	// The URL to the Consul agent: ex. http://host:8500.  Default: http://127.0.0.1:8500
+	Endpoint string `json:"endpoint"`
+
+	// ACL token - if applicable
+	Token string `json:"token"`
+
+	// Datacenter to query.  Default: the datacenter of the agent
+	Datacenter string `json:"datacenter"`
+
+	// Optional tag to limit the services proxied. ex. http
+	Tag string `json:"tag"`
+
+	// The Consul service name Beethoven is registered as (optional).  If set,
+	// will allow for reloading all instances
+	ServiceName string `json:"service_name"`
+
+	// Maximum time a blocking query waits for changes.  Default: 300 seconds
+	WaitTimeSecs int `json:"wait_time_secs"`
+}
+
+type FileConfig struct {
+	// Path to a JSON/YAML file or a directory of files describing apps and their tasks.  Changes
+	// to the file(s) are watched and trigger a reload
+	Path string `json:"path"`
+}
+
+type CompositeConfig struct {
+	// Scheduler types to run together.  Each must be configured in its own section
+	Schedulers []SchedulerType `json:"schedulers"`
+
+	// How to handle apps with the same AppId from different schedulers:
+	//   prefix - (default) the first scheduler listed keeps the AppId, others are prefixed
+	//   first  - the first scheduler listed wins, others are dropped
+	//   merge  - tasks are combined into a single app
+	OnCollision string `json:"on_collision"`
+
+	// Prefix every AppId with its scheduler prefix, regardless of collisions
+	Namespace bool `json:"namespace"`
+
+	// Prefix to use per scheduler (by name: marathon, swarm, kubernetes, consul, file).
+	// Defaults to the scheduler name.  ex. {"marathon": "mesos"} would yield mesos-appid
+	Prefixes map[string]string `json:"prefixes"`
+}
+
+type TemplateConfig struct {
+	// Location of the template
+	Template string `json:"template"`
+
+	// Location of the rendered output.  ex. /etc/nginx/conf.d/team-a.conf
+	Output string `json:"output"`
+
+	// Render the template once per app.  Output must contain {app} which is replaced
+	// with the AppId. ex. /etc/nginx/apps.d/{app}.conf.  Files matching the output that no
+	// longer belong to an app are removed so a dedicated directory should be used
+	PerApp bool `json:"per_app"`
+}
+
+type AppTemplatesConfig struct {
+	// Directory of the snippet templates, named <name>.template - default: /etc/nginx/templates.d
+	Directory string `json:"directory"`
+
+	// Directory the snippets are rendered to as <app>.conf.  Other .conf files in this directory
+	// are removed - default: /etc/nginx/apps.d
+	OutputDir string `json:"output_dir"`
+
+	// Template used by apps without the BT_TEMPLATE label, or selecting a template which
+	// doesn't exist.  Default: default
+	Default string `json:"default"`
+}
+
+type AutoConfig struct {
+	// Render the built-in nginx.conf instead of Template.  Otherwise Template includes the
+	// generated sections as partials, ex. {{> bt_upstreams}} and {{> bt_servers}}
+	Builtin bool `json:"builtin"`
+
+	// Port the generated servers listen on.  Default: 80
+	ListenPort int `json:"listen_port"`
+
+	// Port servers with an app labelled BT_TLS=true also listen on using TLS.  Default: 443
+	TLSListenPort int `json:"tls_listen_port"`
+
+	// Certificate and key used by servers with TLS
+	TLSCertificate    string `json:"tls_certificate"`
+	TLSCertificateKey string `json:"tls_certificate_key"`
+
+	// Templates replacing generated sections, keyed by section name.  Sections are
+	// bt_upstreams, bt_servers, bt_http_extra and bt_default_server_extra.  The last two
+	// are empty hooks for extending the http block and default server
+	Overrides map[string]string `json:"overrides"`
+}
+
+type ProxyConfig struct {
+	// Driver which validates and reloads the proxy (nginx | haproxy).  Default: nginx
+	Driver string `json:"driver"`
+
+	// Path to the proxy executable.  Default: nginx or haproxy found on the PATH
+	Command string `json:"command"`
+
+	// Location of the rendered proxy configuration.  Default: nginx_config for nginx,
+	// /etc/haproxy/haproxy.cfg for haproxy
+	ConfigPath string `json:"config_path"`
+
+	// HAProxy: master CLI socket.  When set HAProxy is expected to run in master-worker
+	// mode and reloads are issued through the master.  ex. /var/run/haproxy-master.sock
+	MasterSocket string `json:"master_socket"`
+
+	// Pid file of the running proxy checked by /bt/ready.  HAProxy also uses it when
+	// reloading without a master socket.  Default: /var/run/nginx.pid for nginx,
+	// /var/run/haproxy.pid for haproxy
+	PidFile string `json:"pid_file"`
+
+	// HAProxy: stats socket the new process retrieves listening sockets from (-x) so
+	// no connections are refused during a reload without a master socket
+	StatsSocket string `json:"stats_socket"`
+
+	// Location the last known good config is backed up to before a new config is installed.
+	// Restored by a rollback when the proxy config didn't exist before the install, ex. after
+	// Beethoven restarts with an empty config directory.  Default: config_path + .bak
+	BackupPath string `json:"backup_path"`
+
+	// URL probed after a reload. ex. http://127.0.0.1/_health.  If it does not respond with
+	// a 2xx status the backed up config is restored and the proxy reloaded again
+	HealthCheckUrl string `json:"health_check_url"`
+
+	// Time the proxy has to pass the health probe after a reload.  Default: 5 seconds
+	HealthCheckTimeoutSecs int `json:"health_check_timeout_secs"`
+
+	// Nginx: HTTP API used to update upstream servers without a reload when only the
+	// tasks of existing apps have changed
+	UpstreamAPI *UpstreamAPIConfig `json:"upstream_api"`
+}
+
+// UpstreamAPIConfig updates the servers of each app's upstream through an API.  Upstreams
+// must be named by the upstreamName helper, ex. upstream {{upstreamName this}} { ... },
+// which auto mode also uses.  The name is the AppId with characters other than letters,
+// digits, '.', '_' and '-' replaced by '-', suffixed with a hash if apps collide
+type UpstreamAPIConfig struct {
+	// Type of API (nginx-plus | dyups)
+	Type string `json:"type"`
+
+	// URL of the API.  ex. http://127.0.0.1:8080/api/6 for nginx-plus or
+	// http://127.0.0.1:8081/upstream for dyups
+	Endpoint string `json:"endpoint"`
+
+	// Timeout of each API request.  Default: 5 seconds
+	TimeoutSecs int `json:"timeout_secs"`
+}
+
+type CoalesceConfig struct {
+	// Time without new events before the config is rendered.  Default: 500
+	QuietPeriodMs int `json:"quiet_period_ms"`
+
+	// Maximum time from the first event before the config is rendered, even if events
+	// keep arriving.  Default: 5000
+	MaxDelayMs int `json:"max_delay_ms"`
+
+	// Minimum time between proxy reloads.  Renders are held back until it has passed
+	// since the last reload.  Default: 2000
+	MinIntervalMs int `json:"min_interval_ms"`
+}
+
+type ReadinessConfig struct {
+	// Maximum age of the last sync with the scheduler.  Apps are only fetched when the
+	// scheduler reports a change so set it above the longest expected quiet period.
+	// Failed fetches always make Beethoven unready.  Default: 0, no maximum age
+	MaxSyncAgeSecs int `json:"max_sync_age_secs"`
+}
+
+type XdsConfig struct {
+	// Port to serve the xDS (ADS, CDS, EDS, LDS, RDS) gRPC API on.  Default: 18000
+	Port int `json:"port"`
+
+	// Address of the generated Envoy HTTP listener.  Default: 0.0.0.0
+	ListenerAddress string `json:"listener_address"`
+
+	// Port of the generated Envoy HTTP listener.  Default: 10000
+	ListenerPort int `json:"listener_port"`
+
+	// Timeout when Envoy connects to a task.  Default: 5000
+	ConnectTimeoutMs int `json:"connect_timeout_ms"`
 }
 
 type reloadContext struct {
@@ -140,7 +463,7 @@ func AddFlags(cmd *cobra.Command) {
 	cmd.Flags().String("name", "beethoven", "Remote: The name of the app, env: CONFIG_NAME")
 	cmd.Flags().String("label", "master", "Remote: The branch to fetch the config from, env: CONFIG_LABEL")
 	cmd.Flags().String("profile", "default", "Remote: The profile to use, env: CONFIG_PROFILE")
-	cmd.Flags().Bool("dryrun", false, "Bypass NGINX validation/reload -- used for debugging logs")
+	cmd.Flags().Bool("dryrun", false, "Bypass proxy validation/reload -- used for debugging logs")
 	cmd.Flags().Bool("root-apps", true, "True by defaults, template context is all apps from marathon.  False, apps is a field in the template as well as config")
 }
 
@@ -275,12 +598,101 @@ func (c *Config) loadDefaults() *Config {
 	if c.NginxConfig == "" {
 		c.NginxConfig = DefaultNginxConfPath
 	}
+
+	if c.Proxy == nil {
+		c.Proxy = &ProxyConfig{}
+	}
+	if c.Proxy.Driver == "" {
+		c.Proxy.Driver = NginxDriver
+	}
+
+	if c.Proxy.Driver == HAProxyDriver {
+		if c.Template == "" {
+			c.Template = DefaultHAProxyTemplatePath
+		}
+		if c.Proxy.ConfigPath == "" {
+			c.Proxy.ConfigPath = DefaultHAProxyConfPath
+		}
+		if c.Proxy.PidFile == "" {
+			c.Proxy.PidFile = DefaultHAProxyPidFile
+		}
+	}
+
 	if c.Template == "" {
 		c.Template = DefaultNginxTemplatePath
 	}
+	if c.Proxy.PidFile == "" {
+		c.Proxy.PidFile = DefaultNginxPidFile
+	}
+	if c.Proxy.ConfigPath == "" {
+		c.Proxy.ConfigPath = c.NginxConfig
+	}
+	if c.Proxy.BackupPath == "" {
+		c.Proxy.BackupPath = c.Proxy.ConfigPath + ".bak"
+	}
 	if c.Scheme == "" {
 		c.Scheme = "http"
 	}
+	if c.TemplateEngine == "" {
+		c.TemplateEngine = HandlebarsEngine
+	}
+
+	if c.Auto != nil {
+		if c.Auto.ListenPort == 0 {
+			c.Auto.ListenPort = DefaultAutoListenPort
+		}
+		if c.Auto.TLSListenPort == 0 {
+			c.Auto.TLSListenPort = DefaultAutoTLSListenPort
+		}
+	}
+
+	if c.AppTemplates != nil {
+		if c.AppTemplates.Directory == "" {
+			c.AppTemplates.Directory = DefaultAppTemplatesDir
+		}
+		if c.AppTemplates.OutputDir == "" {
+			c.AppTemplates.OutputDir = DefaultAppSnippetsDir
+		}
+		if c.AppTemplates.Default == "" {
+			c.AppTemplates.Default = DefaultAppTemplate
+		}
+	}
+
+	if c.Coalesce == nil {
+		c.Coalesce = &CoalesceConfig{}
+	}
+	if c.Coalesce.QuietPeriodMs == 0 {
+		c.Coalesce.QuietPeriodMs = DefaultCoalesceQuietPeriodMs
+	}
+	if c.Coalesce.MaxDelayMs == 0 {
+		c.Coalesce.MaxDelayMs = DefaultCoalesceMaxDelayMs
+	}
+	if c.Coalesce.MinIntervalMs == 0 {
+		c.Coalesce.MinIntervalMs = DefaultCoalesceMinIntervalMs
+	}
+
+	if c.Readiness == nil {
+		c.Readiness = &ReadinessConfig{}
+	}
+
+	if c.Xds != nil {
+		if c.Xds.Port == 0 {
+			c.Xds.Port = DefaultXdsPort
+		}
+		if c.Xds.ListenerAddress == "" {
+			c.Xds.ListenerAddress = "0.0.0.0"
+		}
+		if c.Xds.ListenerPort == 0 {
+			c.Xds.ListenerPort = DefaultXdsListenerPort
+		}
+		if c.Xds.ConnectTimeoutMs == 0 {
+			c.Xds.ConnectTimeoutMs = DefaultXdsConnectTimeoutMs
+		}
+	}
+
+	if c.Composite != nil && c.SchedulerType == 0 {
+		c.SchedulerType = CompositeScheduler
+	}
 
 	if c.Marathon == nil && (c.MarthonUrls != nil && len(c.MarthonUrls) > 0) {
 		c.Marathon = &MarathonConfig{
@@ -304,10 +716,51 @@ func (c *Config) loadDefaults() *Config {
 		}
 	}
 
+	if c.Kubernetes != nil {
+		if c.Kubernetes.Endpoint == "" {
+			c.Kubernetes.Endpoint = DefaultKubernetesEndpoint
+		}
+		if c.SchedulerType == 0 {
+			c.SchedulerType = KubernetesScheduler
+		}
+	}
+
+	if c.Consul != nil {
+		if c.Consul.Endpoint == "" {
+			c.Consul.Endpoint = DefaultConsulEndpoint
+		}
+		if c.SchedulerType == 0 {
+			c.SchedulerType = ConsulScheduler
+		}
+	}
+
+	if c.File != nil && c.SchedulerType == 0 {
+		c.SchedulerType = FileScheduler
+	}
+
 	c.ParseRegEx()
 	return c
 }
 
+// IsSchedulerConfigured determines if the configuration section for the scheduler type is present
+func (c *Config) IsSchedulerConfigured(t SchedulerType) bool {
+	switch t {
+	case MarathonScheduler:
+		return c.Marathon != nil
+	case SwarmScheduler:
+		return c.Swarm != nil
+	case KubernetesScheduler:
+		return c.Kubernetes != nil
+	case ConsulScheduler:
+		return c.Consul != nil
+	case FileScheduler:
+		return c.File != nil
+	case CompositeScheduler:
+		return c.Composite != nil
+	}
+	return false
+}
+
 // ParseRegEx validates and parses that the regex is valid. If the FilterRegExpStr is invalid
 // the value is emptied and an Error is logged
 func (c *Config) ParseRegEx() {
@@ -89,3 +89,54 @@ func TestSchedulerTypeIsValid(t *testing.T) {
 		t.Error("Scheduler type was not Swarm")
 	}
 }
+
+func TestCompositeConfig(t *testing.T) {
+	config, err := loadFromFile(filepath.Join("fixtures", "composite_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.SchedulerType != CompositeScheduler {
+		t.Error("Scheduler type was not Composite")
+	}
+
+	if len(config.Composite.Schedulers) != 2 || config.Composite.Schedulers[1] != SwarmScheduler {
+		t.Error("Expected Marathon and Swarm schedulers")
+	}
+
+	for _, st := range config.Composite.Schedulers {
+		if !config.IsSchedulerConfigured(st) {
+			t.Errorf("Expected %s to be configured", st)
+		}
+	}
+
+	if config.Composite.Prefixes["swarm"] != "docker" {
+		t.Error("Expected 'docker' as prefix for swarm")
+	}
+}
+
+func TestProxyDefaults(t *testing.T) {
+	config, err := loadFromFile(filepath.Join("fixtures", "marathon_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Proxy.Driver != NginxDriver || config.Proxy.ConfigPath != config.NginxConfig {
+		t.Errorf("Expected nginx driver using nginx_config, got %s %s", config.Proxy.Driver, config.Proxy.ConfigPath)
+	}
+}
+
+func TestHAProxyConfig(t *testing.T) {
+	config, err := loadFromFile(filepath.Join("fixtures", "haproxy_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Template != DefaultHAProxyTemplatePath || config.Proxy.ConfigPath != DefaultHAProxyConfPath {
+		t.Errorf("Expected haproxy paths, got %s %s", config.Template, config.Proxy.ConfigPath)
+	}
+
+	if config.Proxy.PidFile != DefaultHAProxyPidFile {
+		t.Errorf("Expected default pid file, got %s", config.Proxy.PidFile)
+	}
+}
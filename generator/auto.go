@@ -0,0 +1,312 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Sections generated in auto mode, registered as partials on every template
+	SectionUpstreams          = "bt_upstreams"
+	SectionServers            = "bt_servers"
+	SectionHttpExtra          = "bt_http_extra"
+	SectionDefaultServerExtra = "bt_default_server_extra"
+
+	defaultServerName = "_"
+)
+
+// autoNginxTemplate is rendered in auto mode when the built-in template is selected.
+// Sections are included using the syntax of the template engine - see autoTemplate
+const autoNginxTemplate = `user  nginx;
+worker_processes  auto;
+
+error_log  /var/log/nginx/error.log warn;
+pid        /var/run/nginx.pid;
+
+events {
+    worker_connections  1024;
+}
+
+http {
+    include       /etc/nginx/mime.types;
+    default_type  application/octet-stream;
+
+    access_log  /dev/stdout;
+    sendfile        on;
+    keepalive_timeout  65;
+
+%s
+%s
+%s
+}
+`
+
+var (
+	autoSections = []string{SectionUpstreams, SectionServers, SectionHttpExtra, SectionDefaultServerExtra}
+
+	invalidUpstreamChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+	// validVHost is a hostname, optionally with a leading wildcard.  ex. *.example.com
+	validVHost = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+	// validPath is a path prefix without characters nginx treats specially (;, {, }, $,
+	// quotes, whitespace, #) so labels can't inject directives
+	validPath = regexp.MustCompile(`^/[A-Za-z0-9._~%/+:@!,=-]*$`)
+)
+
+// autoLocation routes a path prefix of a server to an app
+type autoLocation struct {
+	path     string
+	upstream string
+	strip    bool
+	empty    bool
+}
+
+// autoServer is a virtual host and the locations routed to it
+type autoServer struct {
+	name      string
+	tls       bool
+	locations []*autoLocation
+}
+
+// validateAuto panics if auto mode is configured for a proxy other than nginx or
+// overrides a section which doesn't exist
+func validateAuto(cfg *config.Config) {
+	if cfg.Auto == nil {
+		return
+	}
+
+	if cfg.Proxy.Driver != config.NginxDriver {
+		panic(fmt.Errorf("Auto mode requires the %s driver, got %s", config.NginxDriver, cfg.Proxy.Driver))
+	}
+
+	for name := range cfg.Auto.Overrides {
+		if !isAutoSection(name) {
+			panic(fmt.Errorf("Unknown auto section %s, expected one of %s", name, strings.Join(autoSections, ", ")))
+		}
+	}
+}
+
+// autoTemplate returns the built-in template for the engine
+func autoTemplate(engine TemplateEngine) string {
+	return fmt.Sprintf(autoNginxTemplate, engine.Include(SectionUpstreams), engine.Include(SectionServers), engine.Include(SectionHttpExtra))
+}
+
+func isAutoSection(name string) bool {
+	for _, section := range autoSections {
+		if section == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registerAutoSections generates the sections from the current apps and registers them
+// as partials of the template.  Overridden sections are loaded from their templates
+func (g *Generator) registerAutoSections(tpl Template) error {
+	sections := buildAutoSections(g.cfg.Auto, g.engine, g.templateData.Apps)
+
+	for name, path := range g.cfg.Auto.Overrides {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error loading override of %s: %s", name, err.Error())
+		}
+		sections[name] = string(b)
+	}
+
+	for name, source := range sections {
+		if err := tpl.RegisterPartial(name, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildAutoSections renders the upstreams and servers of every app routed by its labels.
+// Apps are routed when they declare a virtual host or path, apps without a virtual host
+// are routed by the default server
+func buildAutoSections(cfg *config.AutoConfig, engine TemplateEngine, apps map[string]*scheduler.App) map[string]string {
+	upstreams := &bytes.Buffer{}
+	upstreamNames := upstreamNames(apps)
+	servers := map[string]*autoServer{
+		defaultServerName: {name: defaultServerName},
+	}
+
+	for _, id := range sortedAppIds(apps) {
+		app := apps[id]
+		vhosts := app.VHosts()
+		path := app.Path()
+		if len(vhosts) == 0 && path == "" {
+			continue
+		}
+		if err := validateRoute(vhosts, path); err != nil {
+			log.Errorf("App %s: %s, skipping", app.AppId, err.Error())
+			continue
+		}
+
+		if path == "" {
+			path = "/"
+		}
+		if app.StripPrefix() && !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		if len(vhosts) == 0 {
+			if app.TLS() {
+				log.Warningf("App %s: %s requires %s, serving without TLS", app.AppId, scheduler.LabelTLS, scheduler.LabelVHost)
+			}
+			vhosts = []string{defaultServerName}
+		}
+
+		name := upstreamNames[app.AppId]
+		addresses := app.TaskAddresses()
+		if len(addresses) > 0 {
+			fmt.Fprintf(upstreams, "    upstream %s {\n", name)
+			for _, address := range addresses {
+				fmt.Fprintf(upstreams, "        server %s;\n", address)
+			}
+			fmt.Fprintf(upstreams, "    }\n\n")
+		}
+
+		for _, vhost := range vhosts {
+			server, ok := servers[vhost]
+			if !ok {
+				server = &autoServer{name: vhost}
+				servers[vhost] = server
+			}
+
+			if server.hasLocation(path) {
+				log.Warningf("App %s: %s%s is already routed, ignoring", app.AppId, vhost, path)
+				continue
+			}
+
+			server.tls = server.tls || (app.TLS() && vhost != defaultServerName)
+			server.locations = append(server.locations, &autoLocation{
+				path:     path,
+				upstream: name,
+				strip:    app.StripPrefix(),
+				empty:    len(addresses) == 0,
+			})
+		}
+	}
+
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		servers[name].write(buf, cfg, engine)
+	}
+
+	return map[string]string{
+		SectionUpstreams:          upstreams.String(),
+		SectionServers:            buf.String(),
+		SectionHttpExtra:          "",
+		SectionDefaultServerExtra: "",
+	}
+}
+
+// validateRoute checks the virtual hosts and path from the app labels are safe to write
+// into server_name and location directives
+func validateRoute(vhosts []string, path string) error {
+	for _, vhost := range vhosts {
+		if len(vhost) > 253 || !validVHost.MatchString(vhost) {
+			return fmt.Errorf("invalid %s %q", scheduler.LabelVHost, vhost)
+		}
+	}
+	if path != "" && !validPath.MatchString(path) {
+		return fmt.Errorf("invalid %s %q", scheduler.LabelPath, path)
+	}
+	return nil
+}
+
+func (s *autoServer) hasLocation(path string) bool {
+	for _, l := range s.locations {
+		if l.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *autoServer) write(buf *bytes.Buffer, cfg *config.AutoConfig, engine TemplateEngine) {
+	tls := s.tls && cfg.TLSCertificate != ""
+	if s.tls && !tls {
+		log.Warningf("Server %s: TLS requested but no tls_certificate is configured", s.name)
+	}
+
+	fmt.Fprintf(buf, "    server {\n")
+	if s.name == defaultServerName {
+		fmt.Fprintf(buf, "        listen %d default_server;\n", cfg.ListenPort)
+	} else {
+		fmt.Fprintf(buf, "        listen %d;\n", cfg.ListenPort)
+	}
+	if tls {
+		fmt.Fprintf(buf, "        listen %d ssl;\n", cfg.TLSListenPort)
+	}
+	fmt.Fprintf(buf, "        server_name %s;\n", engine.Escape(s.name))
+	if tls {
+		fmt.Fprintf(buf, "        ssl_certificate %s;\n", cfg.TLSCertificate)
+		fmt.Fprintf(buf, "        ssl_certificate_key %s;\n", cfg.TLSCertificateKey)
+	}
+
+	sort.Slice(s.locations, func(i, j int) bool { return s.locations[i].path < s.locations[j].path })
+	for _, l := range s.locations {
+		fmt.Fprintf(buf, "\n        location %s {\n", engine.Escape(l.path))
+		if l.empty {
+			fmt.Fprintf(buf, "            return 503;\n")
+		} else {
+			target := "http://" + l.upstream
+			if l.strip {
+				target += "/"
+			}
+			fmt.Fprintf(buf, "            proxy_pass %s;\n", target)
+			fmt.Fprintf(buf, "            proxy_set_header Host $host;\n")
+			fmt.Fprintf(buf, "            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;\n")
+			fmt.Fprintf(buf, "            proxy_set_header X-Forwarded-Proto $scheme;\n")
+		}
+		fmt.Fprintf(buf, "        }\n")
+	}
+
+	if s.name == defaultServerName {
+		fmt.Fprintf(buf, "\n%s\n", engine.Include(SectionDefaultServerExtra))
+	}
+	fmt.Fprintf(buf, "    }\n\n")
+}
+
+// upstreamName converts the AppId into a valid nginx upstream name.  Different AppIds
+// may convert to the same name, use upstreamNames when naming a set of apps
+func upstreamName(appId string) string {
+	return invalidUpstreamChars.ReplaceAllString(appId, "-")
+}
+
+// upstreamNames returns a unique upstream name for every app keyed by AppId.  Apps whose
+// names collide, ex. /a/b and /a-b, are suffixed with a hash of their AppId
+func upstreamNames(apps map[string]*scheduler.App) map[string]string {
+	byName := map[string][]string{}
+	for _, app := range apps {
+		name := upstreamName(app.AppId)
+		byName[name] = append(byName[name], app.AppId)
+	}
+
+	names := map[string]string{}
+	for name, appIds := range byName {
+		for _, appId := range appIds {
+			if len(appIds) > 1 {
+				names[appId] = fmt.Sprintf("%s-%x", name, sha256.Sum256([]byte(appId)))[:len(name)+9]
+			} else {
+				names[appId] = name
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+package generator
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"strings"
+	"testing"
+)
+
+func TestBuildAutoSections(t *testing.T) {
+	cfg := &config.AutoConfig{ListenPort: 80, TLSListenPort: 443, TLSCertificate: "/etc/ssl/bt.crt", TLSCertificateKey: "/etc/ssl/bt.key"}
+	apps := map[string]*scheduler.App{
+		"web": {
+			AppId:  "web",
+			Labels: map[string]string{scheduler.LabelVHost: "www.example.com", scheduler.LabelTLS: "true"},
+			Tasks:  []scheduler.Task{{Host: "10.0.0.1", Ports: []int{31000, 31001}}},
+		},
+		"api": {
+			AppId: "api",
+			Labels: map[string]string{
+				scheduler.LabelVHost:       "www.example.com",
+				scheduler.LabelPath:        "/api",
+				scheduler.LabelStripPrefix: "true",
+				scheduler.LabelPortIndex:   "1",
+			},
+			Tasks: []scheduler.Task{{Host: "10.0.0.2", Ports: []int{31002, 31003}}},
+		},
+		"admin":    {AppId: "admin", Labels: map[string]string{scheduler.LabelPath: "/admin"}},
+		"internal": {AppId: "internal", Tasks: []scheduler.Task{{Host: "10.0.0.3", Ports: []int{31004}}}},
+	}
+
+	sections := buildAutoSections(cfg, &handlebarsEngine{}, apps)
+	upstreams := sections[SectionUpstreams]
+	servers := sections[SectionServers]
+
+	for _, expected := range []string{"upstream web {\n        server 10.0.0.1:31000;", "upstream api {\n        server 10.0.0.2:31003;"} {
+		if !strings.Contains(upstreams, expected) {
+			t.Errorf("Expected upstreams to contain %q, got:\n%s", expected, upstreams)
+		}
+	}
+	if strings.Contains(upstreams, "internal") || strings.Contains(upstreams, "admin") {
+		t.Errorf("Expected only routed apps with tasks to have upstreams, got:\n%s", upstreams)
+	}
+
+	for _, expected := range []string{
+		"server_name www.example.com;",
+		"listen 443 ssl;",
+		"location /api/ {\n            proxy_pass http://api/;",
+		"location / {\n            proxy_pass http://web;",
+		"location /admin {\n            return 503;",
+		"listen 80 default_server;",
+	} {
+		if !strings.Contains(servers, expected) {
+			t.Errorf("Expected servers to contain %q, got:\n%s", expected, servers)
+		}
+	}
+}
+
+func TestBuildAutoSectionsSkipsUnsafeLabels(t *testing.T) {
+	cfg := &config.AutoConfig{ListenPort: 80}
+	tasks := []scheduler.Task{{Host: "10.0.0.1", Ports: []int{31000}}}
+	apps := map[string]*scheduler.App{
+		"vhost": {AppId: "vhost", Labels: map[string]string{scheduler.LabelVHost: "a.com; location / { alias /; }"}, Tasks: tasks},
+		"path":  {AppId: "path", Labels: map[string]string{scheduler.LabelPath: "/x { alias /; } location /y"}, Tasks: tasks},
+		"web":   {AppId: "web", Labels: map[string]string{scheduler.LabelVHost: "*.example.com", scheduler.LabelPath: "/web-v1/"}, Tasks: tasks},
+	}
+
+	sections := buildAutoSections(cfg, &handlebarsEngine{}, apps)
+	generated := sections[SectionUpstreams] + sections[SectionServers]
+	if strings.Contains(generated, "alias") || strings.Contains(generated, "upstream vhost") || strings.Contains(generated, "upstream path") {
+		t.Errorf("Expected apps with unsafe labels to be skipped, got:\n%s", generated)
+	}
+	if !strings.Contains(generated, "server_name *.example.com;") || !strings.Contains(generated, "location /web-v1/ {") {
+		t.Errorf("Expected valid app to be routed, got:\n%s", generated)
+	}
+}
+
+func TestUpstreamNamesDisambiguatesCollisions(t *testing.T) {
+	tasks := []scheduler.Task{{Host: "10.0.0.1", Ports: []int{31000}}}
+	apps := map[string]*scheduler.App{
+		"/a/b": {AppId: "/a/b", Labels: map[string]string{scheduler.LabelPath: "/b"}, Tasks: tasks},
+		"/a-b": {AppId: "/a-b", Labels: map[string]string{scheduler.LabelPath: "/ab"}, Tasks: tasks},
+		"web":  {AppId: "web", Labels: map[string]string{scheduler.LabelPath: "/web"}, Tasks: tasks},
+	}
+
+	names := upstreamNames(apps)
+	if names["/a/b"] == names["/a-b"] || !strings.HasPrefix(names["/a/b"], "-a-b-") || len(names["/a/b"]) != len("-a-b-")+8 {
+		t.Errorf("Expected colliding names to be suffixed, got %v", names)
+	}
+	if names["web"] != "web" {
+		t.Errorf("Expected unique names to be unchanged, got %s", names["web"])
+	}
+	if n := upstreamNameHelper(apps, apps["/a-b"]); n != names["/a-b"] {
+		t.Errorf("Expected helper to use the same name, got %s", n)
+	}
+
+	upstreams := buildAutoSections(&config.AutoConfig{ListenPort: 80}, &handlebarsEngine{}, apps)[SectionUpstreams]
+	for _, name := range names {
+		if strings.Count(upstreams, "upstream "+name+" {") != 1 {
+			t.Errorf("Expected one upstream %s, got:\n%s", name, upstreams)
+		}
+	}
+}
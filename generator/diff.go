@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/ContainX/beethoven/tracker"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDiffLines is the maximum number of added and removed lines kept in a diff
+	maxDiffLines = 200
+
+	// maxDiffCells bounds the work of the line matching.  Larger changes are reported as
+	// a replacement of the changed region
+	maxDiffCells = 4000000
+)
+
+// newConfigDiff compares the previous and current config line by line
+func newConfigDiff(previous, current string) *tracker.ConfigDiff {
+	diff := &tracker.ConfigDiff{
+		Timestamp: time.Now(),
+		Added:     []tracker.DiffLine{},
+		Removed:   []tracker.DiffLine{},
+	}
+
+	a := splitLines(previous)
+	b := splitLines(current)
+
+	// skip the common prefix and suffix - typically most of the config
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && a[endA-1] == b[endB-1] {
+		endA--
+		endB--
+	}
+
+	removed, added := diffRegion(a[start:endA], b[start:endB])
+	diff.RemovedCount = len(removed)
+	diff.AddedCount = len(added)
+
+	for _, i := range removed {
+		if len(diff.Removed) == maxDiffLines {
+			diff.Truncated = true
+			break
+		}
+		diff.Removed = append(diff.Removed, tracker.DiffLine{Line: start + i + 1, Text: a[start+i]})
+	}
+
+	for _, i := range added {
+		if len(diff.Added) == maxDiffLines {
+			diff.Truncated = true
+			break
+		}
+		diff.Added = append(diff.Added, tracker.DiffLine{Line: start + i + 1, Text: b[start+i]})
+	}
+	return diff
+}
+
+// diffRegion returns the indexes of the lines removed from a and added to b using the
+// longest common subsequence of lines
+func diffRegion(a, b []string) (removed, added []int) {
+	if len(a)*len(b) > maxDiffCells {
+		return indexes(len(a)), indexes(len(b))
+	}
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		removed = append(removed, i)
+	}
+	for ; j < len(b); j++ {
+		added = append(added, j)
+	}
+	return removed, added
+}
+
+func splitLines(contents string) []string {
+	if contents == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+}
+
+func indexes(n int) []int {
+	result := make([]int, n)
+	for i := range result {
+		result[i] = i
+	}
+	return result
+}
+
+// hashConfig identifies config contents for change detection and diffs
+func hashConfig(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestConfigDiff(t *testing.T) {
+	previous := "upstream web {\n  server 10.0.0.1:31000;\n  server 10.0.0.2:31000;\n}\n"
+	current := "upstream web {\n  server 10.0.0.1:31000;\n  server 10.0.0.3:31000;\n}\n"
+
+	diff := newConfigDiff(previous, current)
+	if diff.AddedCount != 1 || diff.RemovedCount != 1 {
+		t.Fatalf("Expected 1 line added and removed, got %d/%d", diff.AddedCount, diff.RemovedCount)
+	}
+
+	if diff.Removed[0].Line != 3 || diff.Removed[0].Text != "  server 10.0.0.2:31000;" {
+		t.Errorf("Unexpected removed line: %v", diff.Removed[0])
+	}
+
+	if diff.Added[0].Line != 3 || diff.Added[0].Text != "  server 10.0.0.3:31000;" {
+		t.Errorf("Unexpected added line: %v", diff.Added[0])
+	}
+}
+
+func TestTemplateAndConfMatchDetectsSameSizeChanges(t *testing.T) {
+	g, driver, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	ioutil.WriteFile(driver.configPath, []byte("server 10.0.0.2:80;"), 0644)
+	if g.templateAndConfMatch(&renderedFile{path: driver.configPath, contents: "server 10.0.0.3:80;"}) {
+		t.Error("Expected configs of the same size to differ")
+	}
+	if !g.templateAndConfMatch(&renderedFile{path: driver.configPath, contents: "server 10.0.0.2:80;"}) {
+		t.Error("Expected identical configs to match")
+	}
+
+	// matched from the hash kept in memory until the installed file is replaced
+	f := &renderedFile{path: driver.configPath, contents: "server 10.0.0.2:80;"}
+	if !g.templateAndConfMatch(f) || f.exists {
+		t.Error("Expected unchanged config to match without reading it")
+	}
+
+	installFile("server 10.0.0.4:80;", driver.configPath, tempTemplateName)
+	f = &renderedFile{path: driver.configPath, contents: "server 10.0.0.2:80;"}
+	if g.templateAndConfMatch(f) || f.installed != "server 10.0.0.4:80;" {
+		t.Errorf("Expected replaced config to be read again, got %s", f.installed)
+	}
+}
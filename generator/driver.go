@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ProxyDriver validates and reloads a specific proxy implementation
+type ProxyDriver interface {
+	// Name of the proxy for logging
+	Name() string
+
+	// ConfigPath is the location of the live proxy configuration
+	ConfigPath() string
+
+	// Validate the specified configuration file without applying it
+	Validate(configFile string) error
+
+	// Reload the proxy so it picks up the configuration at ConfigPath
+	Reload() error
+
+	// Running returns an error if the proxy process is not running
+	Running() error
+}
+
+func newDriver(cfg *config.Config) ProxyDriver {
+	switch cfg.Proxy.Driver {
+	case config.NginxDriver:
+		return newNginxDriver(cfg.Proxy)
+	case config.HAProxyDriver:
+		return newHAProxyDriver(cfg.Proxy)
+	default:
+		panic(fmt.Errorf("Unknown proxy driver: %s", cfg.Proxy.Driver))
+	}
+}
+
+// execCommand runs the command returning an error containing stderr if it fails
+func execCommand(logPrefix, name string, args ...string) error {
+	command := exec.Command(name, args...)
+	stderr := &bytes.Buffer{}
+	command.Stderr = stderr
+
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("%s, %s, output: %s", logPrefix, err.Error(), stderr.String())
+	}
+	return nil
+}
+
+// processRunning returns an error unless the process with the pid is alive.  Signal 0
+// only checks the process exists, EPERM means it is owned by another user
+func processRunning(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.Signal(0)); err != nil && err != syscall.EPERM {
+		return fmt.Errorf("process %d is not running: %s", pid, err.Error())
+	}
+	return nil
+}
+
+// readPids reads the pids in a pid file
+func readPids(pidFile string) ([]string, error) {
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return nil, err
+	}
+	pids := strings.Fields(string(b))
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("pid file %s is empty", pidFile)
+	}
+	return pids, nil
+}
+
+// pidFileRunning returns an error unless one of the processes in the pid file is alive
+func pidFileRunning(pidFile string) error {
+	pids, err := readPids(pidFile)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pids {
+		pid, err := strconv.Atoi(p)
+		if err != nil {
+			return fmt.Errorf("invalid pid %q in %s", p, pidFile)
+		}
+		if err = processRunning(pid); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no process in %s is running", pidFile)
+}
@@ -0,0 +1,32 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPidFileRunning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beethoven")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pidFile := filepath.Join(dir, "nginx.pid")
+	if err := pidFileRunning(pidFile); err == nil {
+		t.Errorf("Expected error for missing pid file")
+	}
+
+	ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	if err := pidFileRunning(pidFile); err != nil {
+		t.Errorf("Expected running, got %s", err.Error())
+	}
+
+	ioutil.WriteFile(pidFile, []byte("abc"), 0644)
+	if err := pidFileRunning(pidFile); err == nil {
+		t.Errorf("Expected error for invalid pid")
+	}
+}
@@ -0,0 +1,154 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"github.com/aymerick/raymond"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Template is a parsed template which can be rendered against TemplateData
+type Template interface {
+	// Exec renders the template with the context
+	Exec(ctx interface{}) (string, error)
+
+	// RegisterPartial adds a named section the template can include
+	RegisterPartial(name, source string) error
+}
+
+// TemplateEngine parses templates of a particular syntax
+type TemplateEngine interface {
+	Name() string
+	Parse(source string) (Template, error)
+	ParseFile(path string) (Template, error)
+
+	// Include returns the syntax including the named partial from a template
+	Include(name string) string
+
+	// Escape quotes text so it is output as is rather than evaluated
+	Escape(s string) string
+}
+
+// newEngine returns the configured template engine.  apps returns the apps being rendered
+// for helpers which search them.  Panics if the engine is unknown
+func newEngine(cfg *config.Config, apps func() map[string]*scheduler.App) TemplateEngine {
+	switch cfg.TemplateEngine {
+	case "", config.HandlebarsEngine:
+		return &handlebarsEngine{helpers: handlebarsHelpers(apps)}
+	case config.GoTemplateEngine:
+		return &goTemplateEngine{}
+	}
+	panic(fmt.Errorf("Unknown template engine %s, expected %s or %s", cfg.TemplateEngine, config.HandlebarsEngine, config.GoTemplateEngine))
+}
+
+type handlebarsEngine struct {
+	helpers map[string]interface{}
+}
+
+type handlebarsTemplate struct {
+	tpl *raymond.Template
+}
+
+func (e *handlebarsEngine) Name() string {
+	return config.HandlebarsEngine
+}
+
+func (e *handlebarsEngine) Parse(source string) (Template, error) {
+	tpl, err := raymond.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	tpl.RegisterHelpers(e.helpers)
+	return &handlebarsTemplate{tpl: tpl}, nil
+}
+
+func (e *handlebarsEngine) ParseFile(path string) (Template, error) {
+	tpl, err := raymond.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tpl.RegisterHelpers(e.helpers)
+	return &handlebarsTemplate{tpl: tpl}, nil
+}
+
+func (e *handlebarsEngine) Include(name string) string {
+	return fmt.Sprintf("{{> %s}}", name)
+}
+
+func (e *handlebarsEngine) Escape(s string) string {
+	return strings.Replace(s, "{{", "\\{{", -1)
+}
+
+func (t *handlebarsTemplate) Exec(ctx interface{}) (string, error) {
+	return t.tpl.Exec(ctx)
+}
+
+// RegisterPartial adds the partial, raymond panics on an invalid partial which is
+// returned as an error
+func (t *handlebarsTemplate) RegisterPartial(name, source string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Error registering partial %s: %v", name, r)
+		}
+	}()
+	t.tpl.RegisterPartial(name, source)
+	return nil
+}
+
+type goTemplateEngine struct{}
+
+type goTemplate struct {
+	tpl *template.Template
+}
+
+func (e *goTemplateEngine) Name() string {
+	return config.GoTemplateEngine
+}
+
+func (e *goTemplateEngine) Parse(source string) (Template, error) {
+	return e.parse("template", source)
+}
+
+func (e *goTemplateEngine) ParseFile(path string) (Template, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.parse(filepath.Base(path), string(b))
+}
+
+func (e *goTemplateEngine) parse(name, source string) (Template, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs()).Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return &goTemplate{tpl: tpl}, nil
+}
+
+func (e *goTemplateEngine) Include(name string) string {
+	return fmt.Sprintf("{{template %q .}}", name)
+}
+
+func (e *goTemplateEngine) Escape(s string) string {
+	return strings.Replace(s, "{{", `{{"{{"}}`, -1)
+}
+
+func (t *goTemplate) Exec(ctx interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.tpl.Execute(buf, ctx); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (t *goTemplate) RegisterPartial(name, source string) error {
+	if _, err := t.tpl.New(name).Parse(source); err != nil {
+		return fmt.Errorf("Error registering partial %s: %s", name, err.Error())
+	}
+	return nil
+}
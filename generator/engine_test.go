@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"testing"
+)
+
+func TestGoTemplateEngine(t *testing.T) {
+	engine := newEngine(&config.Config{TemplateEngine: config.GoTemplateEngine}, nil)
+
+	tpl, err := engine.Parse(`{{range $team, $apps := groupByLabel "TEAM" .Apps}}{{default "none" $team}}:{{range sortBy "Instances" $apps}} {{.AppId}}{{end}}
+{{end}}{{range split "," .Data.hosts}}{{upper (trim .)}};{{end}}
+{{add (len .Apps) 1}} {{if regexMatch "^w" (first (apps .Apps)).AppId}}yes{{else}}no{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &TemplateData{
+		Apps: map[string]*scheduler.App{
+			"api":    {AppId: "api", Instances: 3, Labels: map[string]string{"TEAM": "core"}},
+			"web":    {AppId: "web", Instances: 1, Labels: map[string]string{"TEAM": "core"}},
+			"worker": {AppId: "worker", Instances: 2, Labels: map[string]string{}},
+		},
+		Data: map[string]interface{}{"hosts": "a.com, b.com"},
+	}
+
+	result, err := tpl.Exec(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "none: worker\ncore: web api\nA.COM;B.COM;\n4 no"
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestGoTemplatePartials(t *testing.T) {
+	engine := newEngine(&config.Config{TemplateEngine: config.GoTemplateEngine}, nil)
+
+	tpl, err := engine.Parse("http { " + engine.Include(SectionServers) + " }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tpl.RegisterPartial(SectionServers, "server "+engine.Escape("{{x}}")+";"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := tpl.Exec(&TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "http { server {{x}}; }" {
+		t.Errorf("Unexpected result %q", result)
+	}
+}
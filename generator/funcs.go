@@ -0,0 +1,342 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/scheduler"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the functions available to templates using the Go engine.  Names
+// and argument order follow sprig so the last argument can be piped
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// defaults
+		"default":  defaultValue,
+		"empty":    isEmpty,
+		"coalesce": coalesce,
+		"ternary":  ternary,
+
+		// strings
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"quote":      func(v interface{}) string { return strconv.Quote(toString(v)) },
+		"toString":   toString,
+		"atoi":       func(s string) int { i, _ := strconv.Atoi(strings.TrimSpace(s)); return i },
+
+		// regular expressions
+		"regexMatch":      func(pattern, s string) (bool, error) { return regexp.MatchString(pattern, s) },
+		"regexFind":       regexFind,
+		"regexReplaceAll": regexReplaceAll,
+
+		// arithmetic
+		"add": func(a, b int) int { return a + b },
+		"sub": func(a, b int) int { return a - b },
+		"mul": func(a, b int) int { return a * b },
+		"div": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		},
+		"mod": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a % b, nil
+		},
+		"max": func(a, b int) int {
+			if a > b {
+				return a
+			}
+			return b
+		},
+		"min": func(a, b int) int {
+			if a < b {
+				return a
+			}
+			return b
+		},
+
+		// collections
+		"list":         func(v ...interface{}) []interface{} { return v },
+		"dict":         dict,
+		"keys":         keys,
+		"first":        first,
+		"last":         last,
+		"sortAlpha":    sortAlpha,
+		"sortBy":       sortBy,
+		"apps":         appList,
+		"groupByLabel": groupByLabel,
+	}
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+// isEmpty determines if the value is nil or the zero value of its type, including
+// empty slices and maps
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
+
+func coalesce(v ...interface{}) interface{} {
+	for _, value := range v {
+		if !isEmpty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+func ternary(yes, no interface{}, condition bool) interface{} {
+	if condition {
+		return yes
+	}
+	return no
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func join(sep string, v interface{}) string {
+	values := []string{}
+	for _, item := range toSlice(v) {
+		values = append(values, toString(item))
+	}
+	return strings.Join(values, sep)
+}
+
+func regexFind(pattern, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+func regexReplaceAll(pattern, s, replacement string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+func dict(v ...interface{}) (map[string]interface{}, error) {
+	if len(v)%2 != 0 {
+		return nil, fmt.Errorf("dict requires key value pairs")
+	}
+
+	d := map[string]interface{}{}
+	for i := 0; i < len(v); i += 2 {
+		d[toString(v[i])] = v[i+1]
+	}
+	return d, nil
+}
+
+// keys returns the sorted keys of a map
+func keys(m interface{}) []string {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return []string{}
+	}
+
+	k := []string{}
+	for _, key := range rv.MapKeys() {
+		k = append(k, toString(key.Interface()))
+	}
+	sort.Strings(k)
+	return k
+}
+
+func first(v interface{}) interface{} {
+	items := toSlice(v)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+func last(v interface{}) interface{} {
+	items := toSlice(v)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[len(items)-1]
+}
+
+func sortAlpha(v interface{}) []string {
+	values := []string{}
+	for _, item := range toSlice(v) {
+		values = append(values, toString(item))
+	}
+	sort.Strings(values)
+	return values
+}
+
+// sortBy sorts a list, or the values of a map, by a field of each item.  Fields are
+// compared numerically if they are numbers, otherwise as strings.  The field may also
+// be a label, ex. sortBy "Labels.BT_VHOST" .Apps
+func sortBy(field string, v interface{}) ([]interface{}, error) {
+	items := toSlice(v)
+	values := make([]reflect.Value, len(items))
+	for i, item := range items {
+		value, err := fieldValue(item, field)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	indexes := make([]int, len(items))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return lessValue(values[indexes[i]], values[indexes[j]])
+	})
+
+	sorted := make([]interface{}, len(items))
+	for i, index := range indexes {
+		sorted[i] = items[index]
+	}
+	return sorted, nil
+}
+
+// appList returns the apps sorted by AppId
+func appList(apps map[string]*scheduler.App) []*scheduler.App {
+	list := []*scheduler.App{}
+	for _, id := range sortedAppIds(apps) {
+		list = append(list, apps[id])
+	}
+	return list
+}
+
+// groupByLabel groups apps by the value of a label.  Apps without the label are
+// grouped under an empty value
+func groupByLabel(label string, v interface{}) (map[string][]*scheduler.App, error) {
+	groups := map[string][]*scheduler.App{}
+	for _, item := range toSlice(v) {
+		app, ok := item.(*scheduler.App)
+		if !ok {
+			return nil, fmt.Errorf("groupByLabel expects apps, got %T", item)
+		}
+		value := app.Labels[label]
+		groups[value] = append(groups[value], app)
+	}
+	return groups, nil
+}
+
+// toSlice converts a slice, array or map into a list.  Maps are ordered by key so
+// iteration is stable between renders
+func toSlice(v interface{}) []interface{} {
+	if v == nil {
+		return []interface{}{}
+	}
+
+	rv := reflect.ValueOf(v)
+	items := []interface{}{}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, rv.Index(i).Interface())
+		}
+	case reflect.Map:
+		mapKeys := rv.MapKeys()
+		sort.Slice(mapKeys, func(i, j int) bool {
+			return toString(mapKeys[i].Interface()) < toString(mapKeys[j].Interface())
+		})
+		for _, key := range mapKeys {
+			items = append(items, rv.MapIndex(key).Interface())
+		}
+	default:
+		items = append(items, v)
+	}
+	return items
+}
+
+// fieldValue resolves a dotted path of struct fields and map keys on the item
+func fieldValue(item interface{}, field string) (reflect.Value, error) {
+	value := reflect.ValueOf(item)
+	for _, name := range strings.Split(field, ".") {
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return reflect.Value{}, nil
+			}
+			value = value.Elem()
+		}
+
+		switch value.Kind() {
+		case reflect.Struct:
+			value = value.FieldByName(name)
+			if !value.IsValid() {
+				return reflect.Value{}, fmt.Errorf("sortBy: no field %s", field)
+			}
+		case reflect.Map:
+			value = value.MapIndex(reflect.ValueOf(name))
+			if !value.IsValid() {
+				return reflect.Value{}, nil
+			}
+		default:
+			return reflect.Value{}, fmt.Errorf("sortBy: can't resolve %s on %s", field, value.Kind())
+		}
+	}
+	return value, nil
+}
+
+func lessValue(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+
+	if a.Kind() != b.Kind() {
+		return toString(a.Interface()) < toString(b.Interface())
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	}
+	return toString(a.Interface()) < toString(b.Interface())
+}
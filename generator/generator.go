@@ -1,10 +1,14 @@
 package generator
 
 import (
+	"fmt"
 	"github.com/ContainX/beethoven/config"
 	"github.com/ContainX/beethoven/scheduler"
 	"github.com/ContainX/beethoven/tracker"
+	"github.com/ContainX/beethoven/xds"
 	"github.com/ContainX/depcon/pkg/logger"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -12,9 +16,28 @@ type Generator struct {
 	cfg          *config.Config
 	tracker      *tracker.Tracker
 	scheduler    scheduler.Scheduler
+	driver       ProxyDriver
+	engine       TemplateEngine
+	xds          *xds.Server
+	upstreams    upstreamUpdater
 	reloadQueue  ReloadChan
 	handler      func(proxyConf string)
 	templateData TemplateData
+
+	// structure of the apps in the installed config - see appStructure
+	structure string
+
+	// files replaced by the last install along with their previous contents
+	backup []*renderedFile
+
+	// hashes of the installed files by path - see templateAndConfMatch
+	installedHashes map[string]*installedConfig
+
+	// serializes config generation triggered by events and the API
+	lock sync.Mutex
+
+	// time source of the reload pipeline, the system clock if nil
+	clock clock
 }
 
 type ReloadChan chan bool
@@ -24,13 +47,37 @@ var (
 )
 
 func New(cfg *config.Config, tracker *tracker.Tracker, scheduler scheduler.Scheduler) *Generator {
-	return &Generator{
+	validateAuto(cfg)
+	for _, tc := range cfg.Templates {
+		if tc.PerApp && !strings.Contains(tc.Output, AppPlaceholder) {
+			panic(fmt.Errorf("Per app template %s output must contain %s: %s", tc.Template, AppPlaceholder, tc.Output))
+		}
+	}
+
+	g := &Generator{
 		cfg:          cfg,
 		tracker:      tracker,
 		reloadQueue:  make(chan bool, 2),
 		scheduler:    scheduler,
+		driver:       newDriver(cfg),
 		templateData: TemplateData{},
 	}
+
+	g.engine = newEngine(cfg, g.apps)
+
+	if cfg.Xds != nil {
+		g.xds = xds.New(cfg.Xds)
+	}
+
+	if cfg.Proxy.UpstreamAPI != nil && cfg.Proxy.Driver == config.NginxDriver {
+		g.upstreams = newUpstreamUpdater(cfg.Proxy.UpstreamAPI)
+	}
+	return g
+}
+
+// apps returns the apps currently being rendered
+func (g *Generator) apps() map[string]*scheduler.App {
+	return g.templateData.Apps
 }
 
 // Watch marathon for changes using streams and make callbacks to the specified
@@ -38,54 +85,139 @@ func New(cfg *config.Config, tracker *tracker.Tracker, scheduler scheduler.Sched
 func (g *Generator) Watch(handler func(proxyConf string)) {
 	g.handler = handler
 
+	if g.xds != nil {
+		if err := g.xds.Serve(); err != nil {
+			log.Errorf("Error starting xDS server: %s", err.Error())
+			g.tracker.SetError(tracker.ErrorKindReload, err)
+		}
+	}
+
 	g.scheduler.Watch(g.reloadQueue)
 	g.generateConfig()
 	go g.initReloadWatcher()
 }
 
-// Watches the reload channel and generated a new config
+// Watches the reload channel and generates a new config once events settle
 func (g *Generator) initReloadWatcher() {
-	throttle := time.NewTicker(2 * time.Second)
-	for {
-		select {
-		case <-throttle.C:
-			<-g.reloadQueue
-			log.Info("configuration reload triggered")
-			g.generateConfig()
-		}
-	}
+	g.coalesceReloads(func() {
+		log.Info("configuration reload triggered")
+		g.generateConfig()
+	})
 }
 
 func (g *Generator) ReloadConfiguration() {
 	g.generateConfig()
 }
 
+// ProxyRunning returns an error if the proxy is not running.  Envoy runs outside of
+// Beethoven when serving xDS so it is not checked
+func (g *Generator) ProxyRunning() error {
+	if g.xds != nil {
+		return nil
+	}
+	return g.driver.Running()
+}
+
+// XdsSnapshot returns the current xDS resources as JSON when serving Envoy
+func (g *Generator) XdsSnapshot() ([]byte, error) {
+	if g.xds == nil {
+		return nil, fmt.Errorf("xDS is not enabled")
+	}
+	return g.xds.Dump()
+}
+
 func (g *Generator) generateConfig() {
-	if apps, err := g.scheduler.FetchApps(); err != nil {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	started := time.Now()
+	apps, err := g.scheduler.FetchApps()
+	g.tracker.ObserveFetchApps(time.Since(started), err)
+	if err != nil {
 		log.Error("Skipping config generation...")
-		g.tracker.SetError(err)
+		g.tracker.SetError(tracker.ErrorKindFetch, err)
+		return
+	}
+	g.templateData.Apps = apps
+	g.tracker.SetAppCounts(len(apps), taskCount(apps))
+
+	if g.xds != nil {
+		g.pushSnapshot()
 		return
-	} else {
-		g.templateData.Apps = apps
 	}
 
+	structure := appStructure(g.templateData.Apps)
+
 	changed, err := g.writeConfiguration()
 	if err != nil {
 		log.Error(err.Error())
-		g.tracker.SetError(err)
+		kind := tracker.ErrorKindRender
+		if _, ok := err.(*validationError); ok {
+			kind = tracker.ErrorKindValidate
+		}
+		g.tracker.SetError(kind, err)
 		return
 	}
 
-	if changed {
-		log.Info("Reloading NGINX")
+	if changed && !g.updatedWithoutReload(structure) {
+		log.Infof("Reloading %s", g.driver.Name())
 		err = g.reload()
+		if err == nil {
+			err = g.probeHealth()
+		}
 		if err != nil {
 			log.Error(err.Error())
-			g.tracker.SetError(err)
+			g.tracker.SetError(tracker.ErrorKindReload, err)
+			g.structure = ""
+			g.rollback(err)
 			return
 		}
 	}
+	g.structure = structure
 
 	// No errors - clear tracker
-	g.tracker.SetError(nil)
+	g.tracker.ClearError()
+}
+
+// pushSnapshot publishes the current apps to Envoy.  Envoy applies the changes
+// itself so there is no config to validate or proxy to reload
+func (g *Generator) pushSnapshot() {
+	g.tracker.SetLastConfigRendered(time.Now())
+
+	changed, err := g.xds.Update(g.templateData.Apps)
+	if err != nil {
+		log.Error(err.Error())
+		g.tracker.SetError(tracker.ErrorKindRender, err)
+		return
+	}
+
+	g.tracker.SetLastConfigValid(time.Now())
+	if changed {
+		g.tracker.SetLastProxyReload(time.Now())
+	}
+	g.tracker.ClearError()
+}
+
+// updatedWithoutReload attempts to apply the new config through the upstream API.  This
+// is only possible when the same apps are present and just their tasks have changed.  If
+// the API fails we fall back to a full reload
+func (g *Generator) updatedWithoutReload(structure string) bool {
+	if g.upstreams == nil || g.structure == "" || g.structure != structure {
+		return false
+	}
+
+	if err := g.updateUpstreams(g.templateData.Apps); err != nil {
+		log.Warningf("Upstream API update failed, falling back to reload: %s", err.Error())
+		return false
+	}
+	log.Info("Updated upstream servers without a reload")
+	return true
+}
+
+func taskCount(apps map[string]*scheduler.App) int {
+	count := 0
+	for _, app := range apps {
+		count += len(app.AllTasks())
+	}
+	return count
 }
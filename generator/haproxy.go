@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	haproxyCommand = "haproxy"
+
+	// haproxyMasterTimeout bounds a reload issued through the master CLI
+	haproxyMasterTimeout = 30 * time.Second
+)
+
+type haproxyDriver struct {
+	command      string
+	configPath   string
+	masterSocket string
+	pidFile      string
+	statsSocket  string
+}
+
+func newHAProxyDriver(cfg *config.ProxyConfig) ProxyDriver {
+	command := cfg.Command
+	if command == "" {
+		command = haproxyCommand
+	}
+	return &haproxyDriver{
+		command:      command,
+		configPath:   cfg.ConfigPath,
+		masterSocket: cfg.MasterSocket,
+		pidFile:      cfg.PidFile,
+		statsSocket:  cfg.StatsSocket,
+	}
+}
+
+func (h *haproxyDriver) Name() string {
+	return "HAProxy"
+}
+
+func (h *haproxyDriver) ConfigPath() string {
+	return h.configPath
+}
+
+func (h *haproxyDriver) Validate(configFile string) error {
+	return execCommand("Validate Config:", h.command, "-c", "-q", "-f", configFile)
+}
+
+// Reload HAProxy through the master CLI when running in master-worker mode, otherwise
+// start a new process which takes over from the running one (-sf).  Old processes
+// finish serving their existing connections before exiting
+func (h *haproxyDriver) Reload() error {
+	if h.masterSocket != "" {
+		return h.reloadMaster()
+	}
+	return h.reloadSoftStop()
+}
+
+// reloadMaster issues a reload on the master CLI.  HAProxy 2.7+ reports the result
+// of the reload, older versions simply close the connection
+func (h *haproxyDriver) reloadMaster() error {
+	conn, err := net.DialTimeout("unix", h.masterSocket, haproxyMasterTimeout)
+	if err != nil {
+		return fmt.Errorf("Reload HAProxy:, %s", err.Error())
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(haproxyMasterTimeout))
+	if _, err := conn.Write([]byte("reload\n")); err != nil {
+		return fmt.Errorf("Reload HAProxy:, %s", err.Error())
+	}
+
+	output, _ := ioutil.ReadAll(conn)
+	if strings.Contains(string(output), "Success=0") {
+		return fmt.Errorf("Reload HAProxy:, reload failed, output: %s", string(output))
+	}
+	return nil
+}
+
+func (h *haproxyDriver) reloadSoftStop() error {
+	args := []string{"-D", "-f", h.configPath, "-p", h.pidFile}
+	if h.statsSocket != "" {
+		args = append(args, "-x", h.statsSocket)
+	}
+
+	if pids := h.runningPids(); len(pids) > 0 {
+		args = append(args, "-sf")
+		args = append(args, pids...)
+	}
+	return execCommand("Reload HAProxy:", h.command, args...)
+}
+
+// Running checks the master CLI accepts connections when running in master-worker
+// mode, otherwise that a process in the pid file is alive
+func (h *haproxyDriver) Running() error {
+	if h.masterSocket != "" {
+		conn, err := net.DialTimeout("unix", h.masterSocket, time.Second)
+		if err != nil {
+			return fmt.Errorf("HAProxy is not running: %s", err.Error())
+		}
+		return conn.Close()
+	}
+
+	if err := pidFileRunning(h.pidFile); err != nil {
+		return fmt.Errorf("HAProxy is not running: %s", err.Error())
+	}
+	return nil
+}
+
+// runningPids reads the pids of the running HAProxy processes from the pid file
+func (h *haproxyDriver) runningPids() []string {
+	pids, err := readPids(h.pidFile)
+	if err != nil {
+		log.Warningf("Unable to read HAProxy pid file %s: %s", h.pidFile, err.Error())
+		return nil
+	}
+	return pids
+}
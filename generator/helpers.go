@@ -0,0 +1,177 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/scheduler"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// handlebarsHelpers are the helpers registered on every handlebars template.  Helpers
+// returning apps read them from the generator so they work for both rooted and
+// non-rooted (--root-apps=false) contexts
+//
+//	{{label this "BT_PATH" "/"}}
+//	{{#if (hasLabel this "BT_VHOST")}}
+//	{{#each (appsWithLabel "BT_VHOST")}}
+//	{{#each (filterApps "^products-")}}
+//	{{firstPort this}} {{servicePort this 1}}
+//	{{#each (sortTasks this)}}
+//	{{env "DOMAIN"}}
+//	{{join this.Tasks.[0].Ports ","}}
+//	{{upstreamName this}}
+func handlebarsHelpers(apps func() map[string]*scheduler.App) map[string]interface{} {
+	if apps == nil {
+		apps = func() map[string]*scheduler.App { return nil }
+	}
+
+	return map[string]interface{}{
+		"label":    labelHelper,
+		"hasLabel": hasLabelHelper,
+		"appsWithLabel": func(key string) []*scheduler.App {
+			return appsWithLabel(apps(), key)
+		},
+		"filterApps": func(pattern string) []*scheduler.App {
+			return filterApps(apps(), pattern)
+		},
+		"firstPort":   firstPortHelper,
+		"servicePort": servicePortHelper,
+		"sortTasks":   sortTasksHelper,
+		"env":         os.Getenv,
+		"join":        joinHelper,
+		"upstreamName": func(v interface{}) string {
+			return upstreamNameHelper(apps(), v)
+		},
+	}
+}
+
+// labelHelper returns the value of the label or the default if the app doesn't have it
+func labelHelper(v interface{}, key, def string) string {
+	if app := helperApp(v); app != nil {
+		if value, ok := app.Labels[key]; ok {
+			return value
+		}
+	}
+	return def
+}
+
+func hasLabelHelper(v interface{}, key string) bool {
+	if app := helperApp(v); app != nil {
+		_, ok := app.Labels[key]
+		return ok
+	}
+	return false
+}
+
+// appsWithLabel returns the apps with the label, sorted by AppId
+func appsWithLabel(apps map[string]*scheduler.App, key string) []*scheduler.App {
+	result := []*scheduler.App{}
+	for _, id := range sortedAppIds(apps) {
+		if _, ok := apps[id].Labels[key]; ok {
+			result = append(result, apps[id])
+		}
+	}
+	return result
+}
+
+// filterApps returns the apps whose AppId matches the pattern, sorted by AppId.  An
+// invalid pattern fails rendering of the template
+func filterApps(apps map[string]*scheduler.App, pattern string) []*scheduler.App {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(fmt.Errorf("filterApps: %s", err.Error()))
+	}
+
+	result := []*scheduler.App{}
+	for _, id := range sortedAppIds(apps) {
+		if re.MatchString(apps[id].AppId) {
+			result = append(result, apps[id])
+		}
+	}
+	return result
+}
+
+// firstPortHelper returns the first port of a task, or of the first task of an app.
+// Zero when there are no ports
+func firstPortHelper(v interface{}) int {
+	if task := helperTask(v); task != nil && len(task.Ports) > 0 {
+		return task.Ports[0]
+	}
+	return 0
+}
+
+// servicePortHelper returns the service port at the index of a task, or of the first
+// task of an app.  Zero when there is no such port
+func servicePortHelper(v interface{}, index int) int {
+	if task := helperTask(v); task != nil && index >= 0 && index < len(task.ServicePorts) {
+		return task.ServicePorts[index]
+	}
+	return 0
+}
+
+// sortTasksHelper returns the tasks of an app, or a list of tasks, ordered by host
+// and port so the rendered config doesn't change when the scheduler reorders them
+func sortTasksHelper(v interface{}) []scheduler.Task {
+	var tasks []scheduler.Task
+	switch t := v.(type) {
+	case []scheduler.Task:
+		tasks = append(tasks, t...)
+	default:
+		if app := helperApp(v); app != nil {
+			tasks = append(tasks, app.Tasks...)
+		}
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].Host != tasks[j].Host {
+			return tasks[i].Host < tasks[j].Host
+		}
+		return firstPortHelper(tasks[i]) < firstPortHelper(tasks[j])
+	})
+	return tasks
+}
+
+// joinHelper joins the items of a list with the separator
+func joinHelper(v interface{}, sep string) string {
+	return join(sep, v)
+}
+
+// upstreamNameHelper converts an app or AppId into a valid upstream name, unique among
+// the apps being rendered
+func upstreamNameHelper(apps map[string]*scheduler.App, v interface{}) string {
+	appId := strings.TrimSpace(toString(v))
+	if app := helperApp(v); app != nil {
+		appId = app.AppId
+	}
+
+	if name, ok := upstreamNames(apps)[appId]; ok {
+		return name
+	}
+	return upstreamName(appId)
+}
+
+func helperApp(v interface{}) *scheduler.App {
+	switch app := v.(type) {
+	case *scheduler.App:
+		return app
+	case scheduler.App:
+		return &app
+	}
+	return nil
+}
+
+func helperTask(v interface{}) *scheduler.Task {
+	switch t := v.(type) {
+	case *scheduler.Task:
+		return t
+	case scheduler.Task:
+		return &t
+	}
+
+	if app := helperApp(v); app != nil && len(app.Tasks) > 0 {
+		return &app.Tasks[0]
+	}
+	return nil
+}
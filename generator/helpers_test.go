@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"github.com/ContainX/beethoven/scheduler"
+	"testing"
+)
+
+func TestHandlebarsHelpers(t *testing.T) {
+	apps := map[string]*scheduler.App{
+		"products-web": {
+			AppId:  "products-web",
+			Labels: map[string]string{"BT_VHOST": "shop.example.com"},
+			Tasks: []scheduler.Task{
+				{Host: "10.0.0.2", Ports: []int{31001}, ServicePorts: []int{10000, 10001}},
+				{Host: "10.0.0.1", Ports: []int{31000}, ServicePorts: []int{10000, 10001}},
+			},
+		},
+		"products-api": {AppId: "products-api"},
+		"admin":        {AppId: "admin", Labels: map[string]string{"BT_VHOST": "admin.example.com"}},
+	}
+	helpers := handlebarsHelpers(func() map[string]*scheduler.App { return apps })
+	web := apps["products-web"]
+
+	if v := labelHelper(web, "BT_VHOST", "default"); v != "shop.example.com" {
+		t.Errorf("Unexpected label %s", v)
+	}
+	if v := labelHelper(apps["admin"], "BT_PATH", "/"); v != "/" {
+		t.Errorf("Expected default label, got %s", v)
+	}
+	if !hasLabelHelper(web, "BT_VHOST") || hasLabelHelper(web, "BT_PATH") {
+		t.Error("Unexpected hasLabel result")
+	}
+
+	withVHost := helpers["appsWithLabel"].(func(string) []*scheduler.App)("BT_VHOST")
+	if len(withVHost) != 2 || withVHost[0].AppId != "admin" {
+		t.Errorf("Unexpected apps with label %v", withVHost)
+	}
+
+	products := helpers["filterApps"].(func(string) []*scheduler.App)("^products-")
+	if len(products) != 2 || products[0].AppId != "products-api" {
+		t.Errorf("Unexpected filtered apps %v", products)
+	}
+
+	if p := firstPortHelper(web); p != 31001 {
+		t.Errorf("Expected first port of first task, got %d", p)
+	}
+	if p := servicePortHelper(web, 1); p != 10001 {
+		t.Errorf("Expected service port 10001, got %d", p)
+	}
+	if p := servicePortHelper(apps["admin"], 0); p != 0 {
+		t.Errorf("Expected no service port, got %d", p)
+	}
+
+	if tasks := sortTasksHelper(web); tasks[0].Host != "10.0.0.1" || web.Tasks[0].Host != "10.0.0.2" {
+		t.Error("Expected sorted copy of tasks")
+	}
+	if s := joinHelper(web.Tasks[0].ServicePorts, ","); s != "10000,10001" {
+		t.Errorf("Unexpected join %s", s)
+	}
+	if n := upstreamNameHelper(apps, "group/app:v1"); n != "group-app-v1" {
+		t.Errorf("Unexpected upstream name %s", n)
+	}
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"time"
+)
+
+// clock provides the time to the pipeline so tests can drive it without waiting
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// coalesceReloads folds bursts of scheduler events into a single render.  A render
+// happens once no event has arrived for the quiet period, or when the maximum delay
+// since the first pending event has passed.  Renders are then held back until the
+// minimum interval since the last proxy reload has passed
+func (g *Generator) coalesceReloads(render func()) {
+	quietPeriod := time.Duration(g.cfg.Coalesce.QuietPeriodMs) * time.Millisecond
+	maxDelay := time.Duration(g.cfg.Coalesce.MaxDelayMs) * time.Millisecond
+	minInterval := time.Duration(g.cfg.Coalesce.MinIntervalMs) * time.Millisecond
+
+	clk := g.clock
+	if clk == nil {
+		clk = systemClock{}
+	}
+
+	var quiet, deadline, hold <-chan time.Time
+	pending, forced := false, false
+
+	for {
+		select {
+		case <-g.reloadQueue:
+			g.tracker.RecordReloadEvent(pending)
+			if !pending {
+				pending = true
+				deadline = clk.After(maxDelay)
+			}
+			if hold == nil {
+				quiet = clk.After(quietPeriod)
+			}
+			continue
+		case <-quiet:
+		case <-deadline:
+			log.Infof("Events still arriving after %s, forcing render", maxDelay)
+			forced = true
+		case <-hold:
+			hold = nil
+		}
+
+		quiet, deadline = nil, nil
+
+		lastReload := g.tracker.GetStatus().LastUpdated.LastProxyReload
+		if wait := minInterval - clk.Now().Sub(lastReload); wait > 0 {
+			log.Debugf("Holding render for %s since the last reload", wait)
+			g.tracker.RecordThrottled()
+			hold = clk.After(wait)
+			continue
+		}
+
+		g.tracker.RecordRender(forced)
+		pending, forced = false, false
+		render()
+	}
+}
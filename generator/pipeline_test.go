@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced.  Every timer created is reported on created so
+// tests know the pipeline has handled an event before moving the clock
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	created chan time.Duration
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), created: make(chan time.Duration, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	timer := &fakeTimer{at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	c.lock.Unlock()
+
+	c.created <- d
+	return timer.ch
+}
+
+// Advance moves the clock forward firing the timers which are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.ch <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+func expectTimer(t *testing.T, clk *fakeClock, expected time.Duration) {
+	select {
+	case d := <-clk.created:
+		if d != expected {
+			t.Fatalf("Expected a %s timer, got %s", expected, d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a %s timer", expected)
+	}
+}
+
+func expectRender(t *testing.T, renders chan time.Time) time.Time {
+	select {
+	case rendered := <-renders:
+		return rendered
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a render")
+	}
+	return time.Time{}
+}
+
+func TestCoalesceReloads(t *testing.T) {
+	g, _, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	clk := newFakeClock()
+	g.clock = clk
+	g.cfg.Coalesce = &config.CoalesceConfig{QuietPeriodMs: 50, MaxDelayMs: 1000, MinIntervalMs: 300}
+	g.reloadQueue = make(chan bool, 10)
+
+	renders := make(chan time.Time, 10)
+	go g.coalesceReloads(func() { renders <- clk.Now() })
+
+	// a burst of events restarts the quiet period each time
+	g.reloadQueue <- true
+	expectTimer(t, clk, time.Second)
+	expectTimer(t, clk, 50*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		g.reloadQueue <- true
+		expectTimer(t, clk, 50*time.Millisecond)
+	}
+
+	clk.Advance(50 * time.Millisecond)
+	expectRender(t, renders)
+
+	// a render within the minimum interval of the last reload is held back
+	reloaded := clk.Now()
+	g.tracker.SetLastProxyReload(reloaded)
+	g.reloadQueue <- true
+	expectTimer(t, clk, time.Second)
+	expectTimer(t, clk, 50*time.Millisecond)
+
+	clk.Advance(50 * time.Millisecond)
+	expectTimer(t, clk, 250*time.Millisecond)
+	clk.Advance(250 * time.Millisecond)
+
+	if rendered := expectRender(t, renders); rendered.Sub(reloaded) != 300*time.Millisecond {
+		t.Errorf("Expected render to be held back by the minimum interval, took %s", rendered.Sub(reloaded))
+	}
+
+	counters := g.tracker.GetStatus().Reloads
+	if counters.Events != 6 || counters.Coalesced != 4 || counters.Renders != 2 || counters.Throttled != 1 {
+		t.Errorf("Unexpected counters %+v", counters)
+	}
+}
+
+func TestCoalesceReloadsForcesRenderAfterMaxDelay(t *testing.T) {
+	g, _, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	clk := newFakeClock()
+	g.clock = clk
+	g.cfg.Coalesce = &config.CoalesceConfig{QuietPeriodMs: 50, MaxDelayMs: 100, MinIntervalMs: 1}
+	g.reloadQueue = make(chan bool, 10)
+
+	renders := make(chan time.Time, 10)
+	go g.coalesceReloads(func() { renders <- clk.Now() })
+
+	g.reloadQueue <- true
+	expectTimer(t, clk, 100*time.Millisecond)
+	expectTimer(t, clk, 50*time.Millisecond)
+
+	// events keep arriving within the quiet period until the maximum delay
+	started := clk.Now()
+	for i := 0; i < 2; i++ {
+		clk.Advance(40 * time.Millisecond)
+		g.reloadQueue <- true
+		expectTimer(t, clk, 50*time.Millisecond)
+	}
+
+	clk.Advance(20 * time.Millisecond)
+	if rendered := expectRender(t, renders); rendered.Sub(started) != 100*time.Millisecond {
+		t.Errorf("Expected render forced once the maximum delay passed, at %s", rendered)
+	}
+	if counters := g.tracker.GetStatus().Reloads; counters.Forced != 1 {
+		t.Errorf("Expected a forced render, got %+v", counters)
+	}
+}
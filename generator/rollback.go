@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/tracker"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ProxyHealthCheckTimeoutSec is the default time the proxy has to pass the health
+	// probe after a reload
+	ProxyHealthCheckTimeoutSec = 5
+
+	tempBackupName = ".proxy.conf.bak-"
+)
+
+// backupConfig keeps the installed contents of the files about to be replaced as the
+// last known good config so they can be restored if the new config fails after install.
+// The installed proxy config is also saved to the backup path
+func (g *Generator) backupConfig(files []*renderedFile) error {
+	g.backup = nil
+	for _, f := range files {
+		if f.exists && f.path == g.driver.ConfigPath() {
+			if err := installFile(f.installed, g.cfg.Proxy.BackupPath, tempBackupName); err != nil {
+				return fmt.Errorf("Error backing up config to %s: %s", g.cfg.Proxy.BackupPath, err.Error())
+			}
+		}
+	}
+	g.backup = files
+	return nil
+}
+
+// rollbackFiles returns the files replaced by the last install with their previous
+// contents.  If the proxy config didn't exist before the install, ex. Beethoven restarted
+// with an empty config directory, the copy saved to the backup path by an earlier
+// install is restored instead
+func (g *Generator) rollbackFiles() []*renderedFile {
+	files := make([]*renderedFile, 0, len(g.backup))
+	for _, f := range g.backup {
+		if f.path == g.driver.ConfigPath() && !f.exists {
+			if b, err := ioutil.ReadFile(g.cfg.Proxy.BackupPath); err == nil {
+				log.Infof("Restoring %s from backup %s", f.path, g.cfg.Proxy.BackupPath)
+				f = &renderedFile{path: f.path, installed: string(b), exists: true}
+			}
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// hasBackup determines if any of the files were backed up
+func hasBackup(files []*renderedFile) bool {
+	for _, f := range files {
+		if f.exists {
+			return true
+		}
+	}
+	return false
+}
+
+// restore puts back the previous contents of the files.  Files which did not exist
+// before are removed, except the proxy config which is never left missing
+func (g *Generator) restore(files []*renderedFile) error {
+	for _, f := range files {
+		if !f.exists {
+			if f.path != g.driver.ConfigPath() {
+				os.Remove(f.path)
+			}
+			continue
+		}
+
+		if err := installFile(f.installed, f.path, tempTemplateName); err != nil {
+			return fmt.Errorf("Error restoring %s: %s", f.path, err.Error())
+		}
+	}
+	return nil
+}
+
+// restoreFailed puts back the previous contents of the files after a failed install,
+// recording a failed rollback if they could not be restored
+func (g *Generator) restoreFailed(files []*renderedFile, cause error) {
+	if err := g.restore(files); err != nil {
+		log.Errorf("Unable to restore the previous config: %s", err.Error())
+		g.tracker.SetRollback(&tracker.Rollback{Timestamp: time.Now(), Reason: cause.Error(), Error: err.Error()})
+	}
+}
+
+// rollback restores the last known good config and reloads the proxy again
+func (g *Generator) rollback(cause error) {
+	rb := &tracker.Rollback{Timestamp: time.Now(), Reason: cause.Error()}
+	defer g.tracker.SetRollback(rb)
+
+	files := g.rollbackFiles()
+	if !hasBackup(files) {
+		rb.Error = "No previous config to restore"
+		log.Errorf("Unable to roll back: %s", rb.Error)
+		return
+	}
+
+	log.Warningf("Rolling back to the last known good config: %s", cause.Error())
+
+	err := g.restore(files)
+	if err == nil {
+		err = g.reload()
+	}
+
+	if err != nil {
+		rb.Error = err.Error()
+		log.Errorf("Roll back failed: %s", err.Error())
+		return
+	}
+	rb.Restored = true
+}
+
+// probeHealth checks the proxy is serving after a reload, if a health check URL is
+// configured.  The probe is retried until the timeout expires
+func (g *Generator) probeHealth() error {
+	if g.cfg.Proxy.HealthCheckUrl == "" {
+		return nil
+	}
+
+	timeout := ProxyHealthCheckTimeoutSec * time.Second
+	if g.cfg.Proxy.HealthCheckTimeoutSecs > 0 {
+		timeout = time.Duration(g.cfg.Proxy.HealthCheckTimeoutSecs) * time.Second
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		resp, err := client.Get(g.cfg.Proxy.HealthCheckUrl)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Health check %s failed after reload: %s", g.cfg.Proxy.HealthCheckUrl, err.Error())
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// installFile atomically replaces path with contents by writing a temporary file in
+// the same directory and renaming it
+func installFile(contents, path, tempName string) error {
+	tmpFile, err := writeTempFile(contents, filepath.Dir(path), tempName)
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
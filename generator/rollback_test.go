@@ -0,0 +1,145 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeDriver struct {
+	configPath string
+	reloads    int
+}
+
+func (f *fakeDriver) Name() string                     { return "fake" }
+func (f *fakeDriver) ConfigPath() string               { return f.configPath }
+func (f *fakeDriver) Validate(configFile string) error { return nil }
+func (f *fakeDriver) Running() error                   { return nil }
+func (f *fakeDriver) Reload() error {
+	f.reloads++
+	return nil
+}
+
+func newTestGenerator(t *testing.T) (*Generator, *fakeDriver, func()) {
+	dir, err := ioutil.TempDir("", "beethoven")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Proxy: &config.ProxyConfig{
+		ConfigPath: filepath.Join(dir, "nginx.conf"),
+		BackupPath: filepath.Join(dir, "nginx.conf.bak"),
+	}}
+	driver := &fakeDriver{configPath: cfg.Proxy.ConfigPath}
+	g := &Generator{cfg: cfg, tracker: tracker.New(cfg), driver: driver, engine: &handlebarsEngine{}}
+	return g, driver, func() { os.RemoveAll(dir) }
+}
+
+func TestRollbackRestoresBackup(t *testing.T) {
+	g, driver, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	files := []*renderedFile{{path: driver.configPath, contents: "bad", installed: "good", exists: true}}
+	if err := g.backupConfig(files); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(driver.configPath, []byte("bad"), 0644)
+
+	g.rollback(fmt.Errorf("reload failed"))
+
+	b, _ := ioutil.ReadFile(driver.configPath)
+	if string(b) != "good" {
+		t.Errorf("Expected backup to be restored, got %s", string(b))
+	}
+
+	if b, _ := ioutil.ReadFile(g.cfg.Proxy.BackupPath); string(b) != "good" {
+		t.Errorf("Expected installed config at the backup path, got %s", string(b))
+	}
+
+	if driver.reloads != 1 {
+		t.Errorf("Expected a reload after restoring, got %d", driver.reloads)
+	}
+
+	rb := g.tracker.GetStatus().LastRollback
+	if rb == nil || !rb.Restored || rb.Reason != "reload failed" {
+		t.Errorf("Expected rollback to be recorded, got %v", rb)
+	}
+}
+
+func TestRollbackWithoutBackup(t *testing.T) {
+	g, driver, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	g.backupConfig([]*renderedFile{{path: driver.configPath, contents: "new"}})
+	g.rollback(fmt.Errorf("reload failed"))
+
+	if driver.reloads != 0 {
+		t.Error("Expected no reload without a backup")
+	}
+
+	if rb := g.tracker.GetStatus().LastRollback; rb == nil || rb.Restored {
+		t.Errorf("Expected failed rollback to be recorded, got %v", rb)
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	g, _, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	g.cfg.Proxy.HealthCheckUrl = server.URL
+	g.cfg.Proxy.HealthCheckTimeoutSecs = 1
+	if err := g.probeHealth(); err == nil {
+		t.Error("Expected failing health check to return an error")
+	}
+
+	status = http.StatusOK
+	if err := g.probeHealth(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRollbackRestoresFromBackupPath(t *testing.T) {
+	g, driver, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	// saved by a previous run, the proxy config itself is missing after the restart
+	ioutil.WriteFile(g.cfg.Proxy.BackupPath, []byte("good"), 0644)
+	g.backupConfig([]*renderedFile{{path: driver.configPath, contents: "bad"}})
+	ioutil.WriteFile(driver.configPath, []byte("bad"), 0644)
+
+	g.rollback(fmt.Errorf("reload failed"))
+
+	if b, _ := ioutil.ReadFile(driver.configPath); string(b) != "good" {
+		t.Errorf("Expected config from the backup path to be restored, got %s", string(b))
+	}
+	if rb := g.tracker.GetStatus().LastRollback; rb == nil || !rb.Restored || driver.reloads != 1 {
+		t.Errorf("Expected rollback with a reload, got %v", rb)
+	}
+}
+
+func TestRestoreFailureIsRecorded(t *testing.T) {
+	g, driver, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	missing := filepath.Join(filepath.Dir(driver.configPath), "missing", "app.conf")
+	files := []*renderedFile{{path: missing, contents: "bad", installed: "good", exists: true}}
+
+	g.restoreFailed(files, fmt.Errorf("invalid config"))
+
+	rb := g.tracker.GetStatus().LastRollback
+	if rb == nil || rb.Restored || rb.Error == "" || rb.Reason != "invalid config" {
+		t.Errorf("Expected the failed restore to be recorded, got %+v", rb)
+	}
+}
@@ -8,3 +8,10 @@ type TemplateData struct {
 	Apps map[string]*scheduler.App
 	Data map[string]interface{}
 }
+
+// AppTemplateData is the context of templates rendered once per app
+type AppTemplateData struct {
+	App  *scheduler.App
+	Apps map[string]*scheduler.App
+	Data map[string]interface{}
+}
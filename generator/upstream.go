@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// UpstreamAPITimeoutSec is the default timeout of an upstream API request
+	UpstreamAPITimeoutSec = 5
+)
+
+// upstreamUpdater replaces the servers of a running upstream without a reload
+type upstreamUpdater interface {
+	Update(upstream string, servers []string) error
+}
+
+func newUpstreamUpdater(cfg *config.UpstreamAPIConfig) upstreamUpdater {
+	timeout := UpstreamAPITimeoutSec * time.Second
+	if cfg.TimeoutSecs > 0 {
+		timeout = time.Duration(cfg.TimeoutSecs) * time.Second
+	}
+
+	client := &http.Client{Timeout: timeout}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+
+	switch cfg.Type {
+	case config.UpstreamAPINginxPlus:
+		return &nginxPlusUpdater{endpoint: endpoint, client: client}
+	case config.UpstreamAPIDyups:
+		return &dyupsUpdater{endpoint: endpoint, client: client}
+	default:
+		panic(fmt.Errorf("Unknown upstream API type: %s", cfg.Type))
+	}
+}
+
+// nginxPlusUpdater uses the NGINX Plus API.  Servers are added and removed
+// individually so existing connections to unchanged servers are kept
+type nginxPlusUpdater struct {
+	endpoint string
+	client   *http.Client
+}
+
+type nginxPlusServer struct {
+	ID     int    `json:"id,omitempty"`
+	Server string `json:"server"`
+}
+
+func (n *nginxPlusUpdater) Update(upstream string, servers []string) error {
+	uri := fmt.Sprintf("%s/http/upstreams/%s/servers", n.endpoint, url.PathEscape(upstream))
+
+	current := []nginxPlusServer{}
+	if err := n.do(http.MethodGet, uri, nil, &current); err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, server := range servers {
+		wanted[server] = true
+	}
+
+	for _, server := range current {
+		if wanted[server.Server] {
+			delete(wanted, server.Server)
+			continue
+		}
+		if err := n.do(http.MethodDelete, fmt.Sprintf("%s/%d", uri, server.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+
+	added := make([]string, 0, len(wanted))
+	for server := range wanted {
+		added = append(added, server)
+	}
+	sort.Strings(added)
+
+	for _, server := range added {
+		if err := n.do(http.MethodPost, uri, nginxPlusServer{Server: server}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *nginxPlusUpdater) do(method, uri string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, uri, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Upstream API %s %s returned status: %d, %s", method, uri, resp.StatusCode, string(b))
+	}
+
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// dyupsUpdater uses the ngx_http_dyups_module API which replaces all servers of
+// the upstream at once
+type dyupsUpdater struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (d *dyupsUpdater) Update(upstream string, servers []string) error {
+	body := &bytes.Buffer{}
+	for _, server := range servers {
+		fmt.Fprintf(body, "server %s;", server)
+	}
+
+	uri := fmt.Sprintf("%s/%s", d.endpoint, url.PathEscape(upstream))
+	resp, err := d.client.Post(uri, "text/plain", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Upstream API POST %s returned status: %d, %s", uri, resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// appStructure describes everything about the apps except their tasks.  If the structure
+// is unchanged between renders only upstream membership has changed
+func appStructure(apps map[string]*scheduler.App) string {
+	ids := make([]string, 0, len(apps))
+	for id := range apps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	structure := []interface{}{}
+	for _, id := range ids {
+		app := apps[id]
+		structure = append(structure, []interface{}{
+			app.AppId, app.Id, app.Labels, app.Env, app.Instances,
+			app.HealthChecks, app.PortDefinitions, app.IpPerTask,
+		})
+	}
+
+	// maps are marshalled with sorted keys so the result is stable
+	b, _ := json.Marshal(structure)
+	return string(b)
+}
+
+// updateUpstreams pushes the servers of every app to the running proxy.  Upstreams are
+// named the same way as auto mode and the upstreamName helper name them
+func (g *Generator) updateUpstreams(apps map[string]*scheduler.App) error {
+	names := upstreamNames(apps)
+	for _, app := range apps {
+		if err := g.upstreams.Update(names[app.AppId], app.TaskAddresses()); err != nil {
+			return err
+		}
+	}
+	g.tracker.SetLastUpstreamUpdate(time.Now())
+	return nil
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"encoding/json"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"github.com/ContainX/beethoven/tracker"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestNginxPlusUpdater(t *testing.T) {
+	deleted := []string{}
+	added := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`[{"id": 0, "server": "10.0.0.1:31000"}, {"id": 1, "server": "10.0.0.2:31000"}]`))
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		case http.MethodPost:
+			s := nginxPlusServer{}
+			json.NewDecoder(r.Body).Decode(&s)
+			added = append(added, s.Server)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	updater := newUpstreamUpdater(&config.UpstreamAPIConfig{Type: config.UpstreamAPINginxPlus, Endpoint: server.URL + "/api/6/"})
+	if err := updater.Update("web", []string{"10.0.0.2:31000", "10.0.0.3:31000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "/api/6/http/upstreams/web/servers/0" {
+		t.Errorf("Expected removed server to be deleted, got %v", deleted)
+	}
+
+	if len(added) != 1 || added[0] != "10.0.0.3:31000" {
+		t.Errorf("Expected new server to be added, got %v", added)
+	}
+}
+
+func TestDyupsUpdater(t *testing.T) {
+	body := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = r.URL.Path + " " + string(b)
+	}))
+	defer server.Close()
+
+	updater := newUpstreamUpdater(&config.UpstreamAPIConfig{Type: config.UpstreamAPIDyups, Endpoint: server.URL + "/upstream"})
+	if err := updater.Update("web", []string{"10.0.0.1:31000", "10.0.0.2:31000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "/upstream/web server 10.0.0.1:31000;server 10.0.0.2:31000;" {
+		t.Errorf("Unexpected dyups request: %s", body)
+	}
+}
+
+func TestAppStructureIgnoresTasks(t *testing.T) {
+	apps := func(host string) map[string]*scheduler.App {
+		return map[string]*scheduler.App{
+			"web": {AppId: "web", Labels: map[string]string{"a": "1"}, Tasks: []scheduler.Task{{Host: host, Ports: []int{80}}}},
+		}
+	}
+
+	if appStructure(apps("10.0.0.1")) != appStructure(apps("10.0.0.2")) {
+		t.Error("Expected task changes to keep the same structure")
+	}
+
+	changed := apps("10.0.0.1")
+	changed["web"].Labels["a"] = "2"
+	if appStructure(apps("10.0.0.1")) == appStructure(changed) {
+		t.Error("Expected label changes to change the structure")
+	}
+}
+
+func TestUpdateUpstreamsUsesRenderedNames(t *testing.T) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+	}))
+	defer server.Close()
+
+	apps := map[string]*scheduler.App{
+		"products/web": {
+			AppId:  "products/web",
+			Labels: map[string]string{scheduler.LabelVHost: "web.example.com"},
+			Tasks:  []scheduler.Task{{Host: "10.0.0.1", Ports: []int{31000}}},
+		},
+	}
+
+	cfg := &config.Config{Auto: &config.AutoConfig{ListenPort: 80}}
+	sections := buildAutoSections(cfg.Auto, &handlebarsEngine{}, apps)
+	rendered := regexp.MustCompile(`upstream (\S+) \{`).FindStringSubmatch(sections[SectionUpstreams])
+	if rendered == nil {
+		t.Fatalf("Expected an upstream, got %s", sections[SectionUpstreams])
+	}
+
+	g := &Generator{
+		cfg:       cfg,
+		tracker:   tracker.New(cfg),
+		upstreams: newUpstreamUpdater(&config.UpstreamAPIConfig{Type: config.UpstreamAPIDyups, Endpoint: server.URL}),
+	}
+	if err := g.updateUpstreams(apps); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/"+rendered[1] {
+		t.Errorf("Expected upstream %s to be updated, got %v", rendered[1], paths)
+	}
+}
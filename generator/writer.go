@@ -0,0 +1,415 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"github.com/ContainX/beethoven/tracker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	tempTemplateName = ".proxy.conf.tmp-"
+
+	// AppPlaceholder is replaced with the AppId in the output of per app templates
+	AppPlaceholder = "{app}"
+)
+
+// validationError is returned when the proxy rejects the rendered config
+type validationError struct {
+	error
+}
+
+// renderedFile is a rendered template output along with the currently installed contents
+type renderedFile struct {
+	path      string
+	contents  string
+	installed string
+	exists    bool
+
+	// remove is set for outputs of per app templates whose app no longer exists
+	remove bool
+}
+
+// installedConfig is the hash of an installed file along with the file info at the
+// time it was read
+type installedConfig struct {
+	info os.FileInfo
+	hash string
+}
+
+// writeConfiguration renders every template and installs the outputs that have
+// changed.  The configuration is validated by the proxy before it is kept
+// return true if config has changed and been successfully updated
+func (g *Generator) writeConfiguration() (bool, error) {
+	started := time.Now()
+	files, err := g.renderTemplates()
+	if err != nil {
+		return false, err
+	}
+	g.tracker.ObserveRender(time.Since(started))
+
+	g.tracker.SetLastConfigRendered(time.Now())
+
+	changed := []*renderedFile{}
+	for _, f := range files {
+		if f.remove {
+			log.Infof("removing config: %s", f.path)
+		} else {
+			log.Infof("rendered config: %s, contents: \n\n%s", f.path, f.contents)
+		}
+
+		if g.templateAndConfMatch(f) == false {
+			changed = append(changed, f)
+		}
+	}
+
+	if g.cfg.DryRun() {
+		log.Debugf("Has Changed from Config : %v", len(changed) > 0)
+		return false, nil
+	}
+
+	log.Debugf("Rendered and Current Config Match : %v", len(changed) == 0)
+	if len(changed) == 0 {
+		g.tracker.ClearValidationError()
+		return false, nil
+	}
+
+	if err := g.backupConfig(changed); err != nil {
+		return false, err
+	}
+
+	// A change to only the main config can be validated before it is installed.  Otherwise
+	// files included by the main config have changed so everything is installed and then
+	// validated together, restoring the previous files if validation fails
+	if len(changed) == 1 && changed[0].path == g.driver.ConfigPath() && !changed[0].remove {
+		err = g.validateAndInstall(changed[0])
+	} else {
+		err = g.installAndValidate(changed)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	g.recordDiff(changed)
+	return true, nil
+}
+
+// templateConfigs returns the configured templates or the single template rendered
+// to the proxy config.  An empty template is the built-in auto mode template
+func (g *Generator) templateConfigs() []*config.TemplateConfig {
+	if len(g.cfg.Templates) > 0 {
+		return g.cfg.Templates
+	}
+	if g.cfg.Auto != nil && g.cfg.Auto.Builtin {
+		return []*config.TemplateConfig{{Output: g.driver.ConfigPath()}}
+	}
+	return []*config.TemplateConfig{{Template: g.cfg.Template, Output: g.driver.ConfigPath()}}
+}
+
+// parseTemplate loads the template and registers the auto mode sections
+func (g *Generator) parseTemplate(path string) (Template, error) {
+	var tpl Template
+	var err error
+
+	if path == "" {
+		tpl, err = g.engine.Parse(autoTemplate(g.engine))
+	} else {
+		tpl, err = g.engine.ParseFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error loading template %s: %s", path, err.Error())
+	}
+
+	if g.cfg.Auto != nil {
+		if err := g.registerAutoSections(tpl); err != nil {
+			return nil, err
+		}
+	}
+	return tpl, nil
+}
+
+// renderTemplates renders every template.  Per app templates are rendered once for each
+// app and their outputs which no longer belong to an app are marked for removal
+func (g *Generator) renderTemplates() ([]*renderedFile, error) {
+	if g.cfg.Data != nil {
+		g.templateData.Data = g.cfg.Data
+	} else {
+		g.templateData.Data = map[string]interface{}{}
+	}
+
+	var ctx interface{} = g.templateData.Apps
+	if g.cfg.IsTemplatedAppRooted() == false {
+		ctx = g.templateData
+	}
+
+	files := []*renderedFile{}
+	for _, tc := range g.templateConfigs() {
+		tpl, err := g.parseTemplate(tc.Template)
+		if err != nil {
+			return nil, err
+		}
+
+		if !tc.PerApp {
+			result, err := tpl.Exec(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("Error rendering template %s: %s", tc.Template, err.Error())
+			}
+			files = append(files, &renderedFile{path: tc.Output, contents: result})
+			continue
+		}
+
+		perApp, err := g.renderPerApp(tc.Output, func(app *scheduler.App) (Template, error) {
+			return tpl, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, perApp...)
+	}
+
+	if g.cfg.AppTemplates != nil {
+		snippets, err := g.renderAppSnippets()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, snippets...)
+	}
+	return files, nil
+}
+
+// renderPerApp renders the template of each app to the output with AppPlaceholder replaced
+// by the AppId.  Existing outputs which no longer belong to an app are marked for removal
+func (g *Generator) renderPerApp(output string, template func(app *scheduler.App) (Template, error)) ([]*renderedFile, error) {
+	files := []*renderedFile{}
+	rendered := map[string]bool{}
+
+	for _, id := range sortedAppIds(g.templateData.Apps) {
+		app := g.templateData.Apps[id]
+		tpl, err := template(app)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := tpl.Exec(&AppTemplateData{App: app, Apps: g.templateData.Apps, Data: g.templateData.Data})
+		if err != nil {
+			return nil, fmt.Errorf("Error rendering template for %s: %s", app.AppId, err.Error())
+		}
+
+		path := strings.Replace(output, AppPlaceholder, app.AppId, -1)
+		files = append(files, &renderedFile{path: path, contents: result})
+		rendered[path] = true
+	}
+
+	existing, _ := filepath.Glob(strings.Replace(output, AppPlaceholder, "*", -1))
+	for _, path := range existing {
+		if !rendered[path] {
+			files = append(files, &renderedFile{path: path, remove: true})
+		}
+	}
+	return files, nil
+}
+
+// renderAppSnippets renders a snippet for every app using the template named by its
+// LabelTemplate label.  Apps without the label, or naming a template which can't be
+// loaded, use the default template
+func (g *Generator) renderAppSnippets() ([]*renderedFile, error) {
+	at := g.cfg.AppTemplates
+	templates := map[string]Template{}
+
+	load := func(name string) (Template, error) {
+		if tpl, ok := templates[name]; ok {
+			return tpl, nil
+		}
+		if name != filepath.Base(name) || name == ".." {
+			return nil, fmt.Errorf("Invalid template name %s", name)
+		}
+
+		path := filepath.Join(at.Directory, name+".template")
+		tpl, err := g.engine.ParseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading template %s: %s", path, err.Error())
+		}
+		templates[name] = tpl
+		return tpl, nil
+	}
+
+	output := filepath.Join(at.OutputDir, AppPlaceholder+".conf")
+	return g.renderPerApp(output, func(app *scheduler.App) (Template, error) {
+		if name := app.TemplateName(); name != "" && name != at.Default {
+			tpl, err := load(name)
+			if err == nil {
+				return tpl, nil
+			}
+			log.Warningf("App %s: %s, using the %s template", app.AppId, err.Error(), at.Default)
+		}
+		return load(at.Default)
+	})
+}
+
+// validateAndInstall validates the file using a temporary copy and installs it if valid
+func (g *Generator) validateAndInstall(f *renderedFile) error {
+	tplFilename, err := writeTempFile(f.contents, filepath.Dir(f.path), tempTemplateName)
+	defer g.removeTempFile(tplFilename)
+
+	if err != nil {
+		return err
+	}
+
+	if err = g.validateConfig(tplFilename); err != nil {
+		g.tracker.SetValidationError(err, f.contents)
+		return &validationError{err}
+	}
+	g.tracker.ClearValidationError()
+
+	log.Debugf("Renaming %s to %s", tplFilename, f.path)
+	if err := os.Rename(tplFilename, f.path); err != nil {
+		return fmt.Errorf("Error renaming %s to %s: %s", tplFilename, f.path, err.Error())
+	}
+	return nil
+}
+
+// installAndValidate installs all the files and then validates the proxy config.  If the
+// config is invalid the previous files are restored
+func (g *Generator) installAndValidate(files []*renderedFile) error {
+	for _, f := range files {
+		var err error
+		if f.remove {
+			err = os.Remove(f.path)
+		} else {
+			err = installFile(f.contents, f.path, tempTemplateName)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("Error installing %s: %s", f.path, err.Error())
+			g.restoreFailed(files, err)
+			return err
+		}
+	}
+
+	if err := g.validateConfig(g.driver.ConfigPath()); err != nil {
+		g.restoreFailed(files, err)
+
+		failed := []string{}
+		for _, f := range files {
+			if !f.remove {
+				failed = append(failed, fmt.Sprintf("# %s\n%s", f.path, f.contents))
+			}
+		}
+		g.tracker.SetValidationError(err, strings.Join(failed, "\n"))
+		return &validationError{err}
+	}
+	g.tracker.ClearValidationError()
+	return nil
+}
+
+// recordDiff records what changed in each of the installed files
+func (g *Generator) recordDiff(files []*renderedFile) {
+	diffs := []*tracker.ConfigDiff{}
+	for _, f := range files {
+		diff := newConfigDiff(f.installed, f.contents)
+		diff.Path = f.path
+		diff.PreviousHash = hashConfig(f.installed)
+		diff.CurrentHash = hashConfig(f.contents)
+		log.Infof("Config %s changed: %d lines added, %d lines removed", f.path, diff.AddedCount, diff.RemovedCount)
+		diffs = append(diffs, diff)
+	}
+	g.tracker.SetConfigDiff(diffs)
+}
+
+func (g *Generator) removeTempFile(file string) {
+	os.Remove(file)
+}
+
+// Validates the configuration file using the proxy driver
+func (g *Generator) validateConfig(tplFilename string) error {
+	started := time.Now()
+	err := g.driver.Validate(tplFilename)
+	g.tracker.ObserveValidation(time.Since(started), err)
+	if err != nil {
+		return err
+	}
+	g.tracker.SetLastConfigValid(time.Now())
+
+	return nil
+}
+
+func (g *Generator) reload() error {
+	started := time.Now()
+	err := g.driver.Reload()
+	g.tracker.ObserveReload(time.Since(started), err)
+	if err != nil {
+		return err
+	}
+	g.tracker.SetLastProxyReload(time.Now())
+	return nil
+}
+
+// Determines whether there are any differences between the newly rendered
+// file and the installed one.  If these are the same we bypass reloading the
+// proxy.  The contents are compared by hash so a change of any kind is detected,
+// even if the size remains the same.  The hash of the installed file is kept in
+// memory until the file is replaced or modified, so it is only read when it has
+// changed.  The installed contents are kept on the file for diffing and backup
+// return bool - true if the two files match
+func (g *Generator) templateAndConfMatch(f *renderedFile) bool {
+	hash := hashConfig(f.contents)
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning(err.Error())
+		}
+		return false
+	}
+
+	if c, ok := g.installedHashes[f.path]; ok && !f.remove && c.hash == hash && sameFile(c.info, info) {
+		return true
+	}
+
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		log.Warning(err.Error())
+		return false
+	}
+
+	f.installed = string(b)
+	f.exists = true
+
+	if g.installedHashes == nil {
+		g.installedHashes = map[string]*installedConfig{}
+	}
+	g.installedHashes[f.path] = &installedConfig{info: info, hash: hashConfig(f.installed)}
+	return !f.remove && g.installedHashes[f.path].hash == hash
+}
+
+// sameFile determines if the file has not been replaced or modified
+func sameFile(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+func sortedAppIds(apps map[string]*scheduler.App) []string {
+	ids := make([]string, 0, len(apps))
+	for id := range apps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func writeTempFile(contents, baseDir, fileName string) (string, error) {
+	tmpFile, err := ioutil.TempFile(baseDir, fileName)
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(contents)
+	return tmpFile.Name(), err
+
+}
@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPerAppTemplates(t *testing.T) {
+	g, _, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	dir := filepath.Dir(g.cfg.Proxy.ConfigPath)
+	tpl := filepath.Join(dir, "app.template")
+	ioutil.WriteFile(tpl, []byte("upstream {{App.AppId}} {}\n"), 0644)
+
+	appsDir := filepath.Join(dir, "apps.d")
+	os.Mkdir(appsDir, 0755)
+	stale := filepath.Join(appsDir, "removed.conf")
+	ioutil.WriteFile(stale, []byte("upstream removed {}\n"), 0644)
+
+	g.cfg.Templates = []*config.TemplateConfig{
+		{Template: tpl, Output: filepath.Join(appsDir, AppPlaceholder+".conf"), PerApp: true},
+	}
+	g.templateData.Apps = map[string]*scheduler.App{
+		"api": {AppId: "api"},
+		"web": {AppId: "web"},
+	}
+
+	changed, err := g.writeConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Expected config to have changed")
+	}
+
+	for _, id := range []string{"api", "web"} {
+		if _, err := os.Stat(filepath.Join(appsDir, id+".conf")); err != nil {
+			t.Errorf("Expected config for %s: %s", id, err)
+		}
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected stale app config to be removed")
+	}
+
+	if changed, _ = g.writeConfiguration(); changed {
+		t.Error("Expected no change when rendering the same apps")
+	}
+}
+
+func TestAppTemplateSnippets(t *testing.T) {
+	g, _, cleanup := newTestGenerator(t)
+	defer cleanup()
+
+	dir := filepath.Dir(g.cfg.Proxy.ConfigPath)
+	templatesDir := filepath.Join(dir, "templates.d")
+	os.Mkdir(templatesDir, 0755)
+	ioutil.WriteFile(filepath.Join(templatesDir, "default.template"), []byte("upstream {{App.AppId}} {}\n"), 0644)
+	ioutil.WriteFile(filepath.Join(templatesDir, "websocket.template"), []byte("upstream {{App.AppId}} { keepalive 8; }\n"), 0644)
+
+	g.cfg.Template = filepath.Join(dir, "nginx.template")
+	ioutil.WriteFile(g.cfg.Template, []byte("include apps.d/*.conf;\n"), 0644)
+
+	g.cfg.AppTemplates = &config.AppTemplatesConfig{
+		Directory: templatesDir,
+		OutputDir: filepath.Join(dir, "apps.d"),
+		Default:   config.DefaultAppTemplate,
+	}
+	os.Mkdir(g.cfg.AppTemplates.OutputDir, 0755)
+
+	g.templateData.Apps = map[string]*scheduler.App{
+		"api":  {AppId: "api"},
+		"chat": {AppId: "chat", Labels: map[string]string{scheduler.LabelTemplate: "websocket"}},
+		"web":  {AppId: "web", Labels: map[string]string{scheduler.LabelTemplate: "../default"}},
+	}
+
+	files, err := g.renderTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippets := map[string]bool{}
+	for _, f := range files {
+		snippets[f.path] = true
+	}
+	for _, id := range []string{"api", "chat", "web"} {
+		if !snippets[filepath.Join(g.cfg.AppTemplates.OutputDir, id+".conf")] {
+			t.Errorf("Expected a snippet for %s", id)
+		}
+	}
+}
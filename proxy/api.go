@@ -2,25 +2,77 @@ package proxy
 
 import (
 	"fmt"
-	"github.com/ContainX/depcon/pkg/encoding"
+	"github.com/ContainX/beethoven/tracker"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 )
 
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// getStatus serves the tracker status.  While the last config generation has failed
+// the status is served with a 503 so monitors can alert on the status code alone
 func (p *Proxy) getStatus(w http.ResponseWriter, r *http.Request) {
-	json, err := encoding.DefaultJSONEncoder().MarshalIndent(p.tracker.GetStatus())
-	if err != nil {
-		fmt.Fprintf(w, "Error: %s", err.Error())
+	status := p.tracker.GetStatus()
+
+	code := http.StatusOK
+	if status.LastError != nil {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+// getMetrics serves metrics in the Prometheus text exposition format
+func (p *Proxy) getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", tracker.MetricsContentType)
+	p.tracker.WriteMetrics(w)
+}
+
+// getHistory serves the most recent events, newest first.  Supports the query
+// parameters offset, limit (default 50, max 500) and type
+func (p *Proxy) getHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "offset must be a positive number")
 		return
 	}
-	fmt.Fprint(w, json)
+
+	limit, err := queryInt(query.Get("limit"), defaultHistoryLimit)
+	if err != nil || limit < 1 || limit > maxHistoryLimit {
+		writeError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxHistoryLimit)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p.tracker.History(offset, limit, query.Get("type")))
+}
+
+func queryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
 }
 
 func (p *Proxy) getConfig(w http.ResponseWriter, r *http.Request) {
-	b, err := ioutil.ReadFile(p.cfg.NginxConfig)
-	if err != nil {
-		fmt.Fprintf(w, "Error: %s", err.Error())
+	var b []byte
+	var err error
+
+	if p.cfg.Xds != nil {
+		b, err = p.generator.XdsSnapshot()
+	} else {
+		b, err = ioutil.ReadFile(p.cfg.Proxy.ConfigPath)
+	}
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, "No config has been written: %s", err.Error())
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Error reading config: %s", err.Error())
 	} else {
 		w.Write(b)
 	}
@@ -33,7 +85,7 @@ func (p *Proxy) reloadConfig(w http.ResponseWriter, r *http.Request) {
 			p.generator.ReloadConfiguration()
 		}
 	} else {
-		log.Error("Reload Configuration - invalid method %s", r.Method)
+		log.Errorf("Reload Configuration - invalid method %s", r.Method)
 	}
 }
 
@@ -42,23 +94,23 @@ func (p *Proxy) reloadConfig(w http.ResponseWriter, r *http.Request) {
 func (p *Proxy) reloadAll(w http.ResponseWriter, r *http.Request) {
 	instances, err := p.scheduler.FetchBeethovenInstances()
 	if err != nil {
-		log.Error("Error - reload all: %s", err.Error())
+		log.Errorf("Error - reload all: %s", err.Error())
 		return
 	}
 
 	if r.Method != http.MethodPost {
-		log.Error("Reload Configuration - invalid method %s", r.Method)
+		log.Errorf("Reload Configuration - invalid method %s", r.Method)
 		return
 	}
 
 	for _, instance := range instances {
-		log.Info("Sending reload to instance: %s:%d", instance.Host, instance.Port)
+		log.Infof("Sending reload to instance: %s:%d", instance.Host, instance.Port)
 		uri := fmt.Sprintf("%s://%s:%d/bt/reload/", p.cfg.Scheme, instance.Host, instance.Port)
 		r, err := http.DefaultClient.Post(uri, "application/json", strings.NewReader("{}"))
 		if err != nil {
 			log.Error(err.Error())
 		} else {
-			log.Info("%s:%d response: %d", instance.Host, instance.Port, r.StatusCode)
+			log.Infof("%s:%d response: %d", instance.Host, instance.Port, r.StatusCode)
 		}
 	}
 }
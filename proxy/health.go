@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	healthOk       = "ok"
+	healthDegraded = "degraded"
+)
+
+type healthResponse struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// getHealth reports Beethoven is up.  Use /bt/ready to check the config is current
+func (p *Proxy) getHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, &healthResponse{Status: healthOk})
+}
+
+// getReady reports whether the scheduler is connected, apps have been synced recently,
+// the last config rendered is valid and the proxy is running.  Responds with 503 and
+// the reasons when degraded
+func (p *Proxy) getReady(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	maxSyncAge := time.Duration(p.cfg.Readiness.MaxSyncAgeSecs) * time.Second
+	reasons := p.tracker.Unready(maxSyncAge)
+	if err := p.generator.ProxyRunning(); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+
+	if len(reasons) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, &healthResponse{Status: healthDegraded, Reasons: reasons})
+		return
+	}
+	writeJSON(w, http.StatusOK, &healthResponse{Status: healthOk})
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"github.com/ContainX/depcon/pkg/encoding"
+	"net/http"
+)
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// errorResponse is the body of every failed API request
+type errorResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// writeJSON writes v as the JSON body of the response with the status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	json, err := encoding.DefaultJSONEncoder().MarshalIndent(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		json = fmt.Sprintf(`{"status": %d, "message": "Error encoding response"}`, status)
+		log.Errorf("Error encoding response: %s", err.Error())
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	fmt.Fprint(w, json)
+}
+
+// writeError writes an errorResponse with the status code
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, &errorResponse{Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// allowMethod writes a 405 response if the request does not use method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "Method %s not allowed, use %s", r.Method, method)
+	return false
+}
@@ -42,6 +42,10 @@ func New(cfg *config.Config) *Proxy {
 func (p *Proxy) initRoutes() {
 	p.mux.HandleFunc("/bt", p.getVersion)
 	p.mux.HandleFunc("/bt/status/", p.getStatus)
+	p.mux.HandleFunc("/bt/health", p.getHealth)
+	p.mux.HandleFunc("/bt/ready", p.getReady)
+	p.mux.HandleFunc("/bt/metrics", p.getMetrics)
+	p.mux.HandleFunc("/bt/history", p.getHistory)
 	p.mux.HandleFunc("/bt/config/", p.getConfig)
 	p.mux.HandleFunc("/bt/reload/", p.reloadConfig)
 	p.mux.HandleFunc("/bt/reloadall/", p.reloadAll)
@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"sort"
+	"sync"
+)
+
+const (
+	CollisionPrefix = "prefix"
+	CollisionFirst  = "first"
+	CollisionMerge  = "merge"
+)
+
+// compositeService runs multiple schedulers concurrently and merges their
+// applications into a single template context
+type compositeService struct {
+	*schedulerService
+	backends []*compositeBackend
+	shutdown ShutdownChan
+}
+
+type compositeBackend struct {
+	name      string
+	prefix    string
+	scheduler Scheduler
+	reload    chan bool
+}
+
+type backendApps struct {
+	apps map[string]*App
+	err  error
+}
+
+func createCompositeScheduler(ss *schedulerService) Scheduler {
+	cc := ss.cfg.Composite
+	if len(cc.Schedulers) == 0 {
+		panic(fmt.Errorf("Composite scheduler requires at least one scheduler"))
+	}
+
+	switch cc.OnCollision {
+	case "", CollisionPrefix, CollisionFirst, CollisionMerge:
+	default:
+		panic(fmt.Errorf("Composite scheduler: unknown on_collision value: %s", cc.OnCollision))
+	}
+
+	composite := &compositeService{schedulerService: ss}
+
+	for _, st := range cc.Schedulers {
+		if st == config.CompositeScheduler {
+			panic(fmt.Errorf("Composite scheduler cannot contain another composite scheduler"))
+		}
+		if !ss.cfg.IsSchedulerConfigured(st) {
+			panic(fmt.Errorf("Composite scheduler: %s is not configured", st))
+		}
+
+		prefix := st.String()
+		if p, ok := cc.Prefixes[st.String()]; ok && p != "" {
+			prefix = p
+		}
+
+		composite.backends = append(composite.backends, &compositeBackend{
+			name:      st.String(),
+			prefix:    prefix,
+			scheduler: newBackend(st, &schedulerService{cfg: ss.cfg, tracker: ss.tracker}),
+		})
+	}
+	return composite
+}
+
+// Watch starts watching every scheduler and fans their reload signals into reload
+func (c *compositeService) Watch(reload chan bool) {
+	c.reload = reload
+	c.shutdown = make(ShutdownChan)
+
+	for _, b := range c.backends {
+		log.Infof("Composite: starting %s scheduler", b.name)
+		b.reload = make(chan bool, 2)
+		go c.forward(b)
+		b.scheduler.Watch(b.reload)
+	}
+}
+
+// Shutdown all schedulers
+func (c *compositeService) Shutdown() {
+	for _, b := range c.backends {
+		b.scheduler.Shutdown()
+	}
+	close(c.shutdown)
+}
+
+// FetchApps fetches from all schedulers concurrently and merges the results.  If any
+// scheduler fails the error is returned so a partial view is never rendered
+func (c *compositeService) FetchApps() (map[string]*App, error) {
+	results := make([]backendApps, len(c.backends))
+
+	var wg sync.WaitGroup
+	for i, b := range c.backends {
+		wg.Add(1)
+		go func(i int, b *compositeBackend) {
+			defer wg.Done()
+			apps, err := b.scheduler.FetchApps()
+			results[i] = backendApps{apps: apps, err: err}
+		}(i, b)
+	}
+	wg.Wait()
+
+	for i, r := range results {
+		if r.err != nil {
+			return nil, fmt.Errorf("%s: %s", c.backends[i].name, r.err.Error())
+		}
+	}
+
+	return c.merge(results), nil
+}
+
+// FetchBeethovenInstances combines the instances found by each scheduler.  An error is
+// only returned if no scheduler was able to provide instances
+func (c *compositeService) FetchBeethovenInstances() ([]*BeethovenInstance, error) {
+	instances := []*BeethovenInstance{}
+	seen := map[string]bool{}
+	var lastErr error
+
+	for _, b := range c.backends {
+		found, err := b.scheduler.FetchBeethovenInstances()
+		if err != nil {
+			log.Warningf("Composite: %s failed to fetch instances: %s", b.name, err.Error())
+			lastErr = err
+			continue
+		}
+		for _, instance := range found {
+			key := fmt.Sprintf("%s:%d", instance.Host, instance.Port)
+			if !seen[key] {
+				seen[key] = true
+				instances = append(instances, instance)
+			}
+		}
+	}
+
+	if len(instances) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return instances, nil
+}
+
+func (c *compositeService) forward(b *compositeBackend) {
+	for {
+		select {
+		case <-b.reload:
+			log.Debugf("Composite: reload triggered by %s", b.name)
+			select {
+			case c.reload <- true:
+			default:
+				log.Warning("Reload queue is full")
+			}
+		case <-c.shutdown:
+			return
+		}
+	}
+}
+
+// merge combines the apps of every scheduler in configured order, resolving AppId
+// collisions using the configured strategy
+func (c *compositeService) merge(results []backendApps) map[string]*App {
+	cc := c.cfg.Composite
+	merged := map[string]*App{}
+
+	for i, r := range results {
+		b := c.backends[i]
+
+		// iterate in a stable order so collisions resolve the same way every time
+		ids := make([]string, 0, len(r.apps))
+		for id := range r.apps {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			// copy so renaming or merging never changes the apps returned by the scheduler
+			copied := *r.apps[id]
+			app := &copied
+
+			if cc.Namespace {
+				app.AppId = b.prefix + "-" + app.AppId
+				merged[app.AppId] = app
+				continue
+			}
+
+			existing, collision := merged[app.AppId]
+			if !collision {
+				merged[app.AppId] = app
+				continue
+			}
+
+			switch cc.OnCollision {
+			case CollisionFirst:
+				log.Debugf("Composite: dropping %s from %s, already defined", app.AppId, b.name)
+			case CollisionMerge:
+				existing.Tasks = append(append([]Task{}, existing.Tasks...), app.Tasks...)
+				existing.IpTasks = append(append([]Task{}, existing.IpTasks...), app.IpTasks...)
+			default:
+				app.AppId = b.prefix + "-" + app.AppId
+				if _, taken := merged[app.AppId]; taken {
+					log.Warningf("Composite: dropping %s from %s, prefixed id is already defined", app.AppId, b.name)
+					continue
+				}
+				merged[app.AppId] = app
+			}
+		}
+	}
+	return merged
+}
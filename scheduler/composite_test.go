@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"testing"
+)
+
+func newTestComposite(cc *config.CompositeConfig) *compositeService {
+	return &compositeService{
+		schedulerService: &schedulerService{cfg: &config.Config{Composite: cc}},
+		backends: []*compositeBackend{
+			{name: "marathon", prefix: "marathon"},
+			{name: "swarm", prefix: "docker"},
+		},
+	}
+}
+
+func compositeResults() []backendApps {
+	return []backendApps{
+		{apps: map[string]*App{
+			"web": {AppId: "web", Tasks: []Task{{Host: "10.0.0.1"}}},
+			"api": {AppId: "api", Tasks: []Task{{Host: "10.0.0.2"}}},
+		}},
+		{apps: map[string]*App{
+			"web":    {AppId: "web", Tasks: []Task{{Host: "10.1.0.1"}}, IpTasks: []Task{{Host: "172.16.0.1"}}},
+			"worker": {AppId: "worker", Tasks: []Task{{Host: "10.1.0.2"}}},
+		}},
+	}
+}
+
+func TestCompositeMergePrefixOnCollision(t *testing.T) {
+	apps := newTestComposite(&config.CompositeConfig{}).merge(compositeResults())
+
+	if len(apps) != 4 {
+		t.Fatalf("Expected 4 apps, got %d", len(apps))
+	}
+
+	if apps["web"].Tasks[0].Host != "10.0.0.1" {
+		t.Error("Expected first scheduler to keep the AppId")
+	}
+
+	if apps["docker-web"] == nil || apps["docker-web"].AppId != "docker-web" {
+		t.Error("Expected colliding app to be prefixed")
+	}
+
+	if apps["worker"] == nil || apps["api"] == nil {
+		t.Error("Expected non colliding apps to keep their AppId")
+	}
+}
+
+func TestCompositeMergeFirst(t *testing.T) {
+	apps := newTestComposite(&config.CompositeConfig{OnCollision: CollisionFirst}).merge(compositeResults())
+
+	if len(apps) != 3 || apps["web"].Tasks[0].Host != "10.0.0.1" {
+		t.Errorf("Expected first definition of web to win, got %v", apps)
+	}
+}
+
+func TestCompositeMergeTasks(t *testing.T) {
+	apps := newTestComposite(&config.CompositeConfig{OnCollision: CollisionMerge}).merge(compositeResults())
+
+	if len(apps) != 3 || len(apps["web"].Tasks) != 2 {
+		t.Errorf("Expected web tasks to be merged, got %v", apps["web"])
+	}
+
+	if len(apps["web"].IpTasks) != 1 || apps["web"].IpTasks[0].Host != "172.16.0.1" {
+		t.Errorf("Expected web IP-per-task tasks to be merged, got %v", apps["web"].IpTasks)
+	}
+}
+
+func TestCompositeMergeNamespace(t *testing.T) {
+	results := compositeResults()
+	apps := newTestComposite(&config.CompositeConfig{Namespace: true}).merge(results)
+
+	for _, id := range []string{"marathon-web", "marathon-api", "docker-web", "docker-worker"} {
+		if apps[id] == nil {
+			t.Errorf("Expected namespaced app %s", id)
+		}
+	}
+
+	if results[0].apps["web"].AppId != "web" {
+		t.Errorf("Expected the scheduler's apps to be left untouched, got %s", results[0].apps["web"].AppId)
+	}
+}
@@ -0,0 +1,432 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ConsulWaitTimeSec is the default maximum time a blocking query waits for changes
+	ConsulWaitTimeSec = 300
+
+	// ConsulMaxRetryDelaySec is the upper bound between retries of a failed blocking query
+	ConsulMaxRetryDelaySec = 30
+
+	consulRequestTimeout = 15 * time.Second
+)
+
+var (
+	// ErrConsulMissingIndex is returned by a blocking query without an X-Consul-Index.
+	// Without it the next query can't block so it is retried with a backoff
+	ErrConsulMissingIndex = errors.New("Consul response is missing X-Consul-Index")
+)
+
+type consulService struct {
+	*schedulerService
+	endpoint     string
+	httpClient   *http.Client
+	streamClient *http.Client
+	waitTime     time.Duration
+	shutdown     ShutdownChan
+	cancel       context.CancelFunc
+}
+
+type consulServiceEntry struct {
+	Node    consulNode     `json:"Node"`
+	Service consulInstance `json:"Service"`
+}
+
+type consulNode struct {
+	Node    string `json:"Node"`
+	Address string `json:"Address"`
+}
+
+type consulInstance struct {
+	ID      string            `json:"ID"`
+	Service string            `json:"Service"`
+	Tags    []string          `json:"Tags"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+type consulHealthCheck struct {
+	Node        string `json:"Node"`
+	CheckID     string `json:"CheckID"`
+	Status      string `json:"Status"`
+	ServiceID   string `json:"ServiceID"`
+	ServiceName string `json:"ServiceName"`
+}
+
+func createConsulScheduler(ss *schedulerService) Scheduler {
+	waitTime := ConsulWaitTimeSec * time.Second
+	if ss.cfg.Consul.WaitTimeSecs > 0 {
+		waitTime = time.Duration(ss.cfg.Consul.WaitTimeSecs) * time.Second
+	}
+
+	return &consulService{
+		schedulerService: ss,
+		endpoint:         strings.TrimRight(ss.cfg.Consul.Endpoint, "/"),
+		httpClient:       &http.Client{Timeout: consulRequestTimeout},
+		// blocking queries may take up to wait time plus 1/16th jitter added by Consul
+		streamClient: &http.Client{Timeout: waitTime + waitTime/16 + consulRequestTimeout},
+		waitTime:     waitTime,
+	}
+}
+
+// Watch for changes using Consul blocking queries on the catalog and health state and
+// trigger a reload when services are added, removed or their health changes.
+func (c *consulService) Watch(reload chan bool) {
+	log.Infof("Starting Consul Watch...")
+	c.reload = reload
+	c.shutdown = make(ShutdownChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	go c.watchQuery(ctx, "/v1/catalog/services", c.catalogChanges())
+	go c.watchQuery(ctx, "/v1/health/state/any", c.healthChanges())
+
+	c.triggerReload()
+}
+
+// Shutdown the current blocking queries
+func (c *consulService) Shutdown() {
+	close(c.shutdown)
+	c.cancel()
+}
+
+// Fetch all services from the catalog along with their passing instances
+func (c *consulService) FetchApps() (map[string]*App, error) {
+	services := map[string][]string{}
+	if _, err := c.get(context.Background(), c.httpClient, "/v1/catalog/services", url.Values{}, &services); err != nil {
+		log.Errorf("Error fetching services: %s", err.Error())
+		return nil, err
+	}
+
+	result := map[string]*App{}
+	for name, tags := range services {
+		if name == "consul" || (c.cfg.Consul.Tag != "" && !containsString(tags, c.cfg.Consul.Tag)) {
+			continue
+		}
+
+		entries, err := c.passingInstances(name)
+		if err != nil {
+			log.Errorf("Error fetching health for service %s: %s", name, err.Error())
+			return nil, err
+		}
+
+		app := consulServiceToApp(name, tags, entries)
+
+		// Only add apps with tasks
+		if len(app.Tasks) > 0 {
+			result[app.AppId] = app
+		}
+	}
+
+	c.tracker.SetLastSync(time.Now())
+	return result, nil
+}
+
+// FetchBeethovenInstances finds all passing instances of the configured Beethoven service
+func (c *consulService) FetchBeethovenInstances() ([]*BeethovenInstance, error) {
+	if c.cfg.Consul.ServiceName == "" {
+		return nil, fmt.Errorf("Consul service name must be specified in the configuration")
+	}
+
+	entries, err := c.passingInstances(c.cfg.Consul.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*BeethovenInstance{}
+	for _, entry := range entries {
+		instances = append(instances, &BeethovenInstance{Host: entry.address(), Port: entry.Service.Port})
+	}
+	return instances, nil
+}
+
+func (c *consulService) passingInstances(name string) ([]consulServiceEntry, error) {
+	q := url.Values{}
+	q.Set("passing", "true")
+	if c.cfg.Consul.Tag != "" {
+		q.Set("tag", c.cfg.Consul.Tag)
+	}
+
+	entries := []consulServiceEntry{}
+	_, err := c.get(context.Background(), c.httpClient, "/v1/health/service/"+name, q, &entries)
+	return entries, err
+}
+
+// watchQuery issues blocking queries against path until shutdown.  Each time the index
+// changes the response is handed to changes which returns the names of the services that
+// were affected.  A reload is triggered if any of those pass the filter
+func (c *consulService) watchQuery(ctx context.Context, path string, changes func(body json.RawMessage) []string) {
+	var index uint64
+	attempts := 0
+	maxDelay := ConsulMaxRetryDelaySec * time.Second
+	source := "consul:" + path
+
+	for {
+		q := url.Values{}
+		q.Set("wait", fmt.Sprintf("%ds", int(c.waitTime.Seconds())))
+		if index > 0 {
+			q.Set("index", strconv.FormatUint(index, 10))
+		}
+
+		body := json.RawMessage{}
+		newIndex, err := c.get(ctx, c.streamClient, path, q, &body)
+		if err == nil && newIndex == 0 {
+			err = ErrConsulMissingIndex
+		}
+
+		select {
+		case <-c.shutdown:
+			c.tracker.SetEventStreamDisconnected(source)
+			return
+		default:
+		}
+
+		if err != nil {
+			attempts++
+			log.Warningf("Blocking query on %s failed: %s", path, err.Error())
+			c.tracker.SetEventStreamReconnecting(source, attempts)
+
+			select {
+			case <-time.After(reconnectDelay(attempts, maxDelay)):
+			case <-c.shutdown:
+				c.tracker.SetEventStreamDisconnected(source)
+				return
+			}
+			continue
+		}
+
+		if attempts > 0 || index == 0 {
+			c.tracker.SetEventStreamConnected(source, c.endpoint)
+		}
+		attempts = 0
+
+		// Indexes going backwards means the Consul state was reset - start over
+		if newIndex < index {
+			index = 0
+			c.triggerReload()
+			continue
+		}
+
+		if newIndex == index {
+			continue
+		}
+
+		first := index == 0
+		index = newIndex
+		changed := changes(body)
+
+		if first {
+			continue
+		}
+
+		c.tracker.SetLastEvent(time.Now())
+		for _, name := range changed {
+			if c.shouldTriggerReload(name, path) {
+				c.triggerReload()
+				break
+			}
+		}
+	}
+}
+
+// catalogChanges returns a change detector for /v1/catalog/services which reports
+// services that were added, removed or had their tags changed
+func (c *consulService) catalogChanges() func(body json.RawMessage) []string {
+	previous := map[string]string{}
+
+	return func(body json.RawMessage) []string {
+		services := map[string][]string{}
+		if err := json.Unmarshal(body, &services); err != nil {
+			log.Warningf("Error decoding catalog: %s", err.Error())
+			return nil
+		}
+
+		current := map[string]string{}
+		for name, tags := range services {
+			sorted := append([]string{}, tags...)
+			sort.Strings(sorted)
+			current[name] = strings.Join(sorted, ",")
+		}
+
+		changed := diffStates(previous, current)
+		previous = current
+		return changed
+	}
+}
+
+// healthChanges returns a change detector for /v1/health/state/any which reports
+// services where the status of any check has changed.  A change to a node level check
+// is reported for every service on that node
+func (c *consulService) healthChanges() func(body json.RawMessage) []string {
+	previous := map[string]string{}
+	previousNodes := map[string][]string{}
+
+	return func(body json.RawMessage) []string {
+		checks := []consulHealthCheck{}
+		if err := json.Unmarshal(body, &checks); err != nil {
+			log.Warningf("Error decoding health state: %s", err.Error())
+			return nil
+		}
+
+		states := map[string][]string{}
+		nodeServices := map[string][]string{}
+		for _, check := range checks {
+			key := "node:" + check.Node
+			if check.ServiceName != "" {
+				key = check.ServiceName
+				nodeServices[check.Node] = append(nodeServices[check.Node], check.ServiceName)
+			}
+			states[key] = append(states[key], check.Node+"/"+check.CheckID+"="+check.Status)
+		}
+
+		current := map[string]string{}
+		for name, s := range states {
+			sort.Strings(s)
+			current[name] = strings.Join(s, ",")
+		}
+
+		changed := []string{}
+		for _, name := range diffStates(previous, current) {
+			if strings.HasPrefix(name, "node:") {
+				node := strings.TrimPrefix(name, "node:")
+				changed = append(changed, nodeServices[node]...)
+				changed = append(changed, previousNodes[node]...)
+				continue
+			}
+			changed = append(changed, name)
+		}
+
+		previous = current
+		previousNodes = nodeServices
+		return changed
+	}
+}
+
+func (c *consulService) triggerReload() {
+	select {
+	case c.reload <- true:
+	default:
+		log.Warning("Reload queue is full")
+	}
+}
+
+// get performs a GET against the Consul HTTP API decoding the response into result and
+// returning the X-Consul-Index of the response
+func (c *consulService) get(ctx context.Context, client *http.Client, path string, query url.Values, result interface{}) (uint64, error) {
+	if c.cfg.Consul.Datacenter != "" {
+		query.Set("dc", c.cfg.Consul.Datacenter)
+	}
+
+	uri := c.endpoint + path
+	if len(query) > 0 {
+		uri = uri + "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.cfg.Consul.Token != "" {
+		req.Header.Set("X-Consul-Token", c.cfg.Consul.Token)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Consul API %s returned status: %d", path, resp.StatusCode)
+	}
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return index, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// consulServiceToApp maps a catalog service and its passing instances to an App.  Tags in
+// the form key=value become labels, bare tags become a label with the value "true".  Service
+// meta is merged over the tags
+func consulServiceToApp(name string, tags []string, entries []consulServiceEntry) *App {
+	app := &App{
+		AppId:  name,
+		Id:     name,
+		Labels: map[string]string{},
+		Env:    map[string]string{},
+		Tasks:  []Task{},
+	}
+
+	for _, tag := range tags {
+		if kv := strings.SplitN(tag, "=", 2); len(kv) == 2 {
+			app.Labels[kv[0]] = kv[1]
+		} else {
+			app.Labels[tag] = "true"
+		}
+	}
+
+	for _, entry := range entries {
+		for k, v := range entry.Service.Meta {
+			app.Labels[k] = v
+		}
+
+		if entry.Service.Port == 0 {
+			continue
+		}
+
+		task := Task{Host: entry.address()}
+		task.setPortMappings(portMappings([]int{entry.Service.Port}, []int{entry.Service.Port}))
+		app.Tasks = append(app.Tasks, task)
+	}
+
+	sort.Sort(tasksByHost(app.Tasks))
+	return app
+}
+
+// address of the instance, falling back to the node address if the service did not
+// register one
+func (e consulServiceEntry) address() string {
+	if e.Service.Address != "" {
+		return e.Service.Address
+	}
+	return e.Node.Address
+}
+
+// diffStates returns the keys that were added, removed or changed between two snapshots
+func diffStates(previous, current map[string]string) []string {
+	changed := []string{}
+	for name, state := range current {
+		if p, found := previous[name]; !found || p != state {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, found := current[name]; !found {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	consulCatalogFixture = `{
+  "consul": [],
+  "web": ["http", "BT_VHOST=web.example.com"],
+  "db": ["tcp"]
+}`
+
+	consulWebFixture = `[
+  {
+    "Node": {"Node": "node-2", "Address": "10.0.0.2"},
+    "Service": {"ID": "web-2", "Service": "web", "Tags": ["http"], "Address": "", "Port": 8081, "Meta": {"team": "search"}}
+  },
+  {
+    "Node": {"Node": "node-1", "Address": "10.0.0.1"},
+    "Service": {"ID": "web-1", "Service": "web", "Tags": ["http"], "Address": "172.17.0.3", "Port": 8080}
+  }
+]`
+)
+
+func TestConsulFetchApps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("X-Consul-Index", "42")
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			fmt.Fprint(w, consulCatalogFixture)
+		case "/v1/health/service/web":
+			if r.URL.Query().Get("passing") != "true" {
+				t.Error("Expected only passing instances to be requested")
+			}
+			fmt.Fprint(w, consulWebFixture)
+		case "/v1/health/service/db":
+			fmt.Fprint(w, "[]")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Consul: &config.ConsulConfig{Endpoint: server.URL, Token: "secret"}}
+	c := createConsulScheduler(&schedulerService{cfg: cfg, tracker: tracker.New(cfg)})
+
+	apps, err := c.FetchApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apps) != 1 {
+		t.Fatalf("Expected only services with passing instances, got %d apps", len(apps))
+	}
+
+	app := apps["web"]
+	if app == nil {
+		t.Fatal("Expected app web")
+	}
+
+	if app.Labels["http"] != "true" || app.Labels["BT_VHOST"] != "web.example.com" || app.Labels["team"] != "search" {
+		t.Errorf("Expected tags and meta to be mapped to labels, got %v", app.Labels)
+	}
+
+	if len(app.Tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(app.Tasks))
+	}
+
+	if app.Tasks[0].Host != "10.0.0.2" || app.Tasks[0].Ports[0] != 8081 {
+		t.Errorf("Expected node address fallback, got %s:%v", app.Tasks[0].Host, app.Tasks[0].Ports)
+	}
+
+	if app.Tasks[1].Host != "172.17.0.3" || app.Tasks[1].Ports[0] != 8080 {
+		t.Errorf("Expected service address, got %s:%v", app.Tasks[1].Host, app.Tasks[1].Ports)
+	}
+}
+
+func TestConsulHealthChanges(t *testing.T) {
+	c := &consulService{}
+	changes := c.healthChanges()
+
+	changes([]byte(`[
+  {"Node": "node-1", "CheckID": "serfHealth", "Status": "passing"},
+  {"Node": "node-1", "CheckID": "service:web-1", "Status": "passing", "ServiceName": "web"},
+  {"Node": "node-1", "CheckID": "service:api-1", "Status": "passing", "ServiceName": "api"}
+]`))
+
+	changed := changes([]byte(`[
+  {"Node": "node-1", "CheckID": "serfHealth", "Status": "passing"},
+  {"Node": "node-1", "CheckID": "service:web-1", "Status": "critical", "ServiceName": "web"},
+  {"Node": "node-1", "CheckID": "service:api-1", "Status": "passing", "ServiceName": "api"}
+]`))
+
+	if len(changed) != 1 || changed[0] != "web" {
+		t.Errorf("Expected only web to change, got %v", changed)
+	}
+
+	changed = changes([]byte(`[
+  {"Node": "node-1", "CheckID": "serfHealth", "Status": "critical"},
+  {"Node": "node-1", "CheckID": "service:web-1", "Status": "critical", "ServiceName": "web"},
+  {"Node": "node-1", "CheckID": "service:api-1", "Status": "passing", "ServiceName": "api"}
+]`))
+
+	if !containsString(changed, "web") || !containsString(changed, "api") {
+		t.Errorf("Expected node check change to affect all services on the node, got %v", changed)
+	}
+}
+
+func TestConsulWatchBacksOffWithoutIndex(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, "{}")
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Consul: &config.ConsulConfig{Endpoint: server.URL}}
+	c := createConsulScheduler(&schedulerService{cfg: cfg, tracker: tracker.New(cfg)}).(*consulService)
+	c.shutdown = make(ShutdownChan)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer close(c.shutdown)
+
+	go c.watchQuery(ctx, "/v1/catalog/services", c.catalogChanges())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !c.tracker.GetStatus().EventStream.Reconnecting && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !c.tracker.GetStatus().EventStream.Reconnecting {
+		t.Fatal("Expected a missing index to be treated as a failure")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected to back off after the first query, got %d queries", n)
+	}
+}
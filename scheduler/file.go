@@ -0,0 +1,256 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/ContainX/go-utils/encoding"
+	"github.com/fsnotify/fsnotify"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type fileService struct {
+	*schedulerService
+	path     string
+	watcher  *fsnotify.Watcher
+	shutdown ShutdownChan
+}
+
+// appsFile is the layout of a static apps file
+type appsFile struct {
+	Apps []fileApp `json:"apps" yaml:"apps"`
+}
+
+type fileApp struct {
+	Id     string            `json:"id" yaml:"id"`
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	Env    map[string]string `json:"env" yaml:"env"`
+	Tasks  []fileTask        `json:"tasks" yaml:"tasks"`
+}
+
+type fileTask struct {
+	Host         string `json:"host" yaml:"host"`
+	Ports        []int  `json:"ports" yaml:"ports"`
+	ServicePorts []int  `json:"service_ports" yaml:"service_ports"`
+	StagedAt     string `json:"staged_at" yaml:"staged_at"`
+	StartedAt    string `json:"started_at" yaml:"started_at"`
+	Version      string `json:"version" yaml:"version"`
+}
+
+func createFileScheduler(ss *schedulerService) Scheduler {
+	return &fileService{
+		schedulerService: ss,
+		path:             filepath.Clean(ss.cfg.File.Path),
+	}
+}
+
+// Watch the file (or directory) for changes and trigger a reload when
+// any of the files are written, created, removed or renamed.
+func (f *fileService) Watch(reload chan bool) {
+	log.Infof("Starting File Watch: %s", f.path)
+	f.reload = reload
+	f.shutdown = make(ShutdownChan)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Error creating file watcher, changes will not be detected: %s", err.Error())
+	} else {
+		// Watch the parent of a single file so editors which replace the file
+		// (write temp + rename) are still detected
+		dir := f.path
+		if info, err := os.Stat(f.path); err == nil && !info.IsDir() {
+			dir = filepath.Dir(f.path)
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			log.Errorf("Error watching %s: %s", dir, err.Error())
+		}
+		f.watcher = watcher
+		go f.watchEvents()
+	}
+
+	f.triggerReload()
+}
+
+// Shutdown the file watcher
+func (f *fileService) Shutdown() {
+	close(f.shutdown)
+	if f.watcher != nil {
+		f.watcher.Close()
+	}
+}
+
+// Fetch all applications described in the file or directory
+func (f *fileService) FetchApps() (map[string]*App, error) {
+	files, err := f.appFiles()
+	if err != nil {
+		log.Errorf("Error listing app files: %s", err.Error())
+		return nil, err
+	}
+
+	result := map[string]*App{}
+	for _, file := range files {
+		af, err := readAppsFile(file)
+		if err != nil {
+			log.Errorf("Error reading %s: %s", file, err.Error())
+			return nil, err
+		}
+
+		for _, fa := range af.Apps {
+			app := fa.toApp()
+			if app.AppId == "" {
+				return nil, fmt.Errorf("App without an id in %s", file)
+			}
+
+			if _, exists := result[app.AppId]; exists {
+				log.Warningf("App %s in %s overrides a previous definition", app.AppId, file)
+			}
+
+			// Only add apps with tasks
+			if len(app.Tasks) > 0 {
+				result[app.AppId] = app
+			} else {
+				delete(result, app.AppId)
+			}
+		}
+	}
+
+	f.tracker.SetLastSync(time.Now())
+	return result, nil
+}
+
+func (f *fileService) FetchBeethovenInstances() ([]*BeethovenInstance, error) {
+	return []*BeethovenInstance{}, nil
+}
+
+func (f *fileService) watchEvents() {
+	for {
+		select {
+		case event, ok := <-f.watcher.Events:
+			if !ok {
+				return
+			}
+			if !f.isAppFile(event.Name) {
+				continue
+			}
+			log.Debugf("File event: %s", event)
+			f.tracker.SetLastEvent(time.Now())
+			// the changed file may hold any number of apps so the filter is left to the render
+			f.tracker.RecordSchedulerEvent(false)
+			f.tracker.SetLastTrigger(fmt.Sprintf("%s: %v", filepath.Base(event.Name), event))
+			f.triggerReload()
+		case err, ok := <-f.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("File watcher error: %s", err.Error())
+		case <-f.shutdown:
+			return
+		}
+	}
+}
+
+func (f *fileService) triggerReload() {
+	select {
+	case f.reload <- true:
+	default:
+		log.Warning("Reload queue is full")
+	}
+}
+
+// appFiles returns the configured file or all supported files within the
+// configured directory sorted by name
+func (f *fileService) appFiles() ([]string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{f.path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && isSupportedAppFile(entry.Name()) {
+			files = append(files, filepath.Join(f.path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isAppFile determines if a changed file is one we are watching
+func (f *fileService) isAppFile(name string) bool {
+	name = filepath.Clean(name)
+	if name == f.path {
+		return true
+	}
+	return filepath.Dir(name) == f.path && isSupportedAppFile(name)
+}
+
+func isSupportedAppFile(name string) bool {
+	if strings.HasPrefix(filepath.Base(name), ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yml", ".yaml":
+		return true
+	}
+	return false
+}
+
+func readAppsFile(file string) (*appsFile, error) {
+	encoder, err := encoding.NewEncoderFromFileExt(file)
+	if err != nil {
+		return nil, err
+	}
+
+	af := &appsFile{}
+	if err := encoder.UnMarshalFile(file, af); err != nil {
+		return nil, err
+	}
+	return af, nil
+}
+
+func (fa fileApp) toApp() *App {
+	app := &App{
+		AppId:  fa.Id,
+		Id:     fa.Id,
+		Labels: fa.Labels,
+		Env:    fa.Env,
+		Tasks:  []Task{},
+	}
+
+	if strings.HasPrefix(fa.Id, "/") {
+		app.AppId = appIdToDashes(fa.Id)
+	}
+
+	if app.Labels == nil {
+		app.Labels = map[string]string{}
+	}
+
+	if app.Env == nil {
+		app.Env = map[string]string{}
+	}
+
+	for _, ft := range fa.Tasks {
+		task := Task{
+			Host:      ft.Host,
+			StagedAt:  ft.StagedAt,
+			StartedAt: ft.StartedAt,
+			Version:   ft.Version,
+		}
+		task.setPortMappings(portMappings(ft.Ports, ft.ServicePorts))
+		app.Tasks = append(app.Tasks, task)
+	}
+	return app
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFileScheduler(path string) Scheduler {
+	cfg := &config.Config{File: &config.FileConfig{Path: path}}
+	return createFileScheduler(&schedulerService{cfg: cfg, tracker: tracker.New(cfg)})
+}
+
+func TestFileFetchApps(t *testing.T) {
+	apps, err := newTestFileScheduler(filepath.Join("fixtures", "apps.json")).FetchApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apps) != 2 {
+		t.Fatalf("Expected 2 apps with tasks, got %d", len(apps))
+	}
+
+	search := apps["products-search"]
+	if search == nil {
+		t.Fatal("Expected slash form id to be converted to products-search")
+	}
+
+	if search.Labels["BT_VHOST"] != "search.example.com" || search.Env["JAVA_OPTS"] != "-Xmx512m" {
+		t.Error("Expected labels and env to be mapped")
+	}
+
+	if len(search.Tasks) != 2 || search.Tasks[1].Host != "10.0.0.2" || search.Tasks[1].Ports[0] != 31001 || search.Tasks[1].ServicePorts[0] != 10000 {
+		t.Errorf("Unexpected tasks: %v", search.Tasks)
+	}
+
+	if apps["static-web"] == nil {
+		t.Error("Expected app static-web")
+	}
+}
+
+func TestFileWatchDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beethoven-apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, contents string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a.json", `{"apps": [{"id": "a", "tasks": [{"host": "10.0.0.1", "ports": [80]}]}]}`)
+	write("ignored.txt", `not an apps file`)
+
+	s := newTestFileScheduler(dir)
+	// the filter matches app ids, never the file names
+	cfg := s.(*fileService).cfg
+	cfg.FilterRegExStr = "^[ab]$"
+	cfg.ParseRegEx()
+
+	reload := make(chan bool, 2)
+	s.Watch(reload)
+	defer s.Shutdown()
+
+	// initial reload
+	<-reload
+
+	write("b.json", `{"apps": [{"id": "b", "tasks": [{"host": "10.0.0.2", "ports": [80]}]}]}`)
+
+	select {
+	case <-reload:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected file change to trigger a reload")
+	}
+
+	apps, err := s.FetchApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apps) != 2 || apps["a"] == nil || apps["b"] == nil {
+		t.Errorf("Expected apps from all files, got %v", apps)
+	}
+}
@@ -0,0 +1,279 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// KubernetesMaxRewatchDelaySec is the upper bound between attempts to re-establish a watch
+	KubernetesMaxRewatchDelaySec = 30
+)
+
+type kubernetesService struct {
+	*schedulerService
+	client   *kubeClient
+	shutdown ShutdownChan
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func createKubernetesScheduler(ss *schedulerService) Scheduler {
+	if ss.cfg.Kubernetes == nil {
+		log.Fatalf("Kubernetes scheduler: the kubernetes configuration section is missing")
+	}
+	client, err := newKubeClient(ss.cfg.Kubernetes)
+	if err != nil {
+		log.Fatalf("Kubernetes scheduler: error creating API client: %s", err.Error())
+	}
+	return &kubernetesService{schedulerService: ss, client: client}
+}
+
+// Watch for changes to Services and Endpoints using the API server watch protocol and
+// trigger a reload when apps have been added, removed or their endpoints change.
+func (k *kubernetesService) Watch(reload chan bool) {
+	log.Infof("Starting Kubernetes Watch...")
+	k.reload = reload
+	k.shutdown = make(ShutdownChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+
+	ns := k.cfg.Kubernetes.Namespace
+	k.wg.Add(2)
+	go k.watchResource(ctx, resourcePath(ns, "services"), k.cfg.Kubernetes.LabelSelector)
+	go k.watchResource(ctx, resourcePath(ns, "endpoints"), "")
+
+	k.triggerReload()
+}
+
+// Shutdown the current watches
+func (k *kubernetesService) Shutdown() {
+	close(k.shutdown)
+	k.cancel()
+	k.wg.Wait()
+}
+
+// Fetch all Services and their ready Endpoints from the API server
+func (k *kubernetesService) FetchApps() (map[string]*App, error) {
+	ns := k.cfg.Kubernetes.Namespace
+
+	services, err := k.client.listServices(ns, k.cfg.Kubernetes.LabelSelector)
+	if err != nil {
+		log.Errorf("Error fetching services: %s", err.Error())
+		return nil, err
+	}
+
+	endpoints, err := k.client.listEndpoints(ns)
+	if err != nil {
+		log.Errorf("Error fetching endpoints: %s", err.Error())
+		return nil, err
+	}
+
+	endpointMap := map[string]*kubeEndpoints{}
+	for i := range endpoints.Items {
+		ep := &endpoints.Items[i]
+		endpointMap[kubeAppId(ep.Metadata)] = ep
+	}
+
+	result := map[string]*App{}
+	for _, svc := range services.Items {
+		if svc.Spec.Type == "ExternalName" {
+			continue
+		}
+
+		appId := kubeAppId(svc.Metadata)
+		ep, found := endpointMap[appId]
+		if !found {
+			continue
+		}
+
+		app := kubeServiceToApp(svc, ep)
+
+		// Only add apps with tasks
+		if len(app.Tasks) > 0 {
+			result[app.AppId] = app
+		}
+	}
+
+	k.tracker.SetLastSync(time.Now())
+	return result, nil
+}
+
+// FetchBeethovenInstances finds all running Beethoven pods matching the configured pod selector
+func (k *kubernetesService) FetchBeethovenInstances() ([]*BeethovenInstance, error) {
+	if k.cfg.Kubernetes.PodSelector == "" {
+		return nil, fmt.Errorf("Kubernetes pod selector must be specified in the configuration")
+	}
+
+	pods, err := k.client.listPods(podNamespace(k.cfg.Kubernetes), k.cfg.Kubernetes.PodSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []*BeethovenInstance{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == "Running" && pod.Status.PodIP != "" {
+			instances = append(instances, &BeethovenInstance{Host: pod.Status.PodIP, Port: k.cfg.HttpPort()})
+		}
+	}
+	return instances, nil
+}
+
+// watchResource keeps a watch open on the resource at path.  Watches are resumed from
+// the last seen resource version; if that version has expired we start over from the
+// current state and trigger a reload since changes may have been missed
+func (k *kubernetesService) watchResource(ctx context.Context, path, selector string) {
+	defer k.wg.Done()
+
+	maxDelay := KubernetesMaxRewatchDelaySec * time.Second
+	resourceVersion := ""
+	attempts := 0
+	source := "kubernetes:" + path
+
+	for {
+		if resourceVersion == "" {
+			rv, err := k.currentResourceVersion(path, selector)
+			if err == nil {
+				resourceVersion = rv
+			} else {
+				log.Errorf("Error listing %s: %s", path, err.Error())
+			}
+		}
+
+		var err error
+		if resourceVersion != "" {
+			k.tracker.SetEventStreamConnected(source, k.cfg.Kubernetes.Endpoint)
+			resourceVersion, err = k.client.watch(ctx, path, selector, resourceVersion, func(eventType string, meta kubeObjectMeta) {
+				attempts = 0
+				k.tracker.SetLastEvent(time.Now())
+				if k.shouldTriggerReload(kubeAppId(meta), eventType) {
+					k.triggerReload()
+				}
+			})
+		}
+
+		select {
+		case <-k.shutdown:
+			k.tracker.SetEventStreamDisconnected(source)
+			return
+		default:
+		}
+
+		if err == ErrWatchExpired {
+			log.Infof("Watch on %s expired, re-listing", path)
+			k.triggerReload()
+			continue
+		}
+
+		attempts++
+		if err != nil {
+			log.Warningf("Watch on %s ended: %s", path, err.Error())
+		}
+
+		delay := reconnectDelay(attempts, maxDelay)
+		k.tracker.SetEventStreamReconnecting(source, attempts)
+
+		select {
+		case <-time.After(delay):
+		case <-k.shutdown:
+			k.tracker.SetEventStreamDisconnected(source)
+			return
+		}
+	}
+}
+
+func (k *kubernetesService) currentResourceVersion(path, selector string) (string, error) {
+	list := &struct {
+		Metadata kubeListMeta `json:"metadata"`
+	}{}
+	if err := k.client.get(path, listQuery(selector), list); err != nil {
+		return "", err
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+func (k *kubernetesService) triggerReload() {
+	select {
+	case k.reload <- true:
+	default:
+		log.Warning("Reload queue is full")
+	}
+}
+
+// kubeServiceToApp maps a Service and its Endpoints to an App.  Annotations are merged
+// over labels so they can be used for routing hints.  Each ready endpoint address becomes
+// a Task with ports ordered as declared on the Service
+func kubeServiceToApp(svc kubeService, ep *kubeEndpoints) *App {
+	app := &App{
+		AppId:  kubeAppId(svc.Metadata),
+		Id:     svc.Metadata.Namespace + "/" + svc.Metadata.Name,
+		Labels: map[string]string{},
+		Env:    map[string]string{},
+		Tasks:  []Task{},
+	}
+
+	for k, v := range svc.Metadata.Labels {
+		app.Labels[k] = v
+	}
+	for k, v := range svc.Metadata.Annotations {
+		app.Labels[k] = v
+	}
+
+	for _, subset := range ep.Subsets {
+		mappings := []PortMapping{}
+
+		for _, sp := range svc.Spec.Ports {
+			for _, p := range subset.Ports {
+				if p.Name == sp.Name {
+					protocol := sp.Protocol
+					if protocol == "" {
+						protocol = "TCP"
+					}
+					mappings = append(mappings, PortMapping{
+						Name:        sp.Name,
+						Protocol:    normalizeProtocol(protocol),
+						Port:        p.Port,
+						ServicePort: sp.Port,
+					})
+					break
+				}
+			}
+		}
+
+		if len(mappings) == 0 {
+			continue
+		}
+
+		for _, addr := range subset.Addresses {
+			task := Task{Host: addr.IP}
+			task.setPortMappings(mappings)
+			app.Tasks = append(app.Tasks, task)
+		}
+	}
+
+	sort.Sort(tasksByHost(app.Tasks))
+	return app
+}
+
+// kubeAppId identifies a Service by namespace and name.  ex: default/web would be default-web
+func kubeAppId(meta kubeObjectMeta) string {
+	return meta.Namespace + "-" + meta.Name
+}
+
+type tasksByHost []Task
+
+func (t tasksByHost) Len() int {
+	return len(t)
+}
+
+func (t tasksByHost) Less(i, j int) bool {
+	return t[i].Host < t[j].Host
+}
+
+func (t tasksByHost) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
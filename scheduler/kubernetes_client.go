@@ -0,0 +1,325 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	kubeServiceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubeServiceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	kubeServiceAccountNS    = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	kubeRequestTimeout = 15 * time.Second
+)
+
+var (
+	// ErrWatchExpired is returned when the resource version we are watching from is too old
+	// and a full re-list is required
+	ErrWatchExpired = errors.New("Kubernetes watch expired, resource version too old")
+)
+
+// kubeClient is a minimal client for the parts of the Kubernetes API server
+// used by the scheduler: listing and watching Services, Endpoints and Pods
+type kubeClient struct {
+	endpoint     string
+	token        string
+	tokenFile    string
+	httpClient   *http.Client
+	streamClient *http.Client
+}
+
+type kubeObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+}
+
+type kubeListMeta struct {
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type kubeServiceList struct {
+	Metadata kubeListMeta  `json:"metadata"`
+	Items    []kubeService `json:"items"`
+}
+
+type kubeService struct {
+	Metadata kubeObjectMeta  `json:"metadata"`
+	Spec     kubeServiceSpec `json:"spec"`
+}
+
+type kubeServiceSpec struct {
+	Type      string            `json:"type"`
+	ClusterIP string            `json:"clusterIP"`
+	Ports     []kubeServicePort `json:"ports"`
+}
+
+type kubeServicePort struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port"`
+	NodePort int    `json:"nodePort"`
+}
+
+type kubeEndpointsList struct {
+	Metadata kubeListMeta    `json:"metadata"`
+	Items    []kubeEndpoints `json:"items"`
+}
+
+type kubeEndpoints struct {
+	Metadata kubeObjectMeta       `json:"metadata"`
+	Subsets  []kubeEndpointSubset `json:"subsets"`
+}
+
+type kubeEndpointSubset struct {
+	Addresses []kubeEndpointAddress `json:"addresses"`
+	Ports     []kubeEndpointPort    `json:"ports"`
+}
+
+type kubeEndpointAddress struct {
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname"`
+	NodeName string `json:"nodeName"`
+}
+
+type kubeEndpointPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+type kubePodList struct {
+	Metadata kubeListMeta `json:"metadata"`
+	Items    []kubePod    `json:"items"`
+}
+
+type kubePod struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Status   kubePodStatus  `json:"status"`
+}
+
+type kubePodStatus struct {
+	Phase string `json:"phase"`
+	PodIP string `json:"podIP"`
+}
+
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type kubeStatus struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func newKubeClient(cfg *config.KubernetesConfig) (*kubeClient, error) {
+	kc := &kubeClient{
+		endpoint:  strings.TrimRight(cfg.Endpoint, "/"),
+		token:     cfg.Token,
+		tokenFile: cfg.TokenFile,
+	}
+
+	if kc.token == "" && kc.tokenFile == "" {
+		if e, _ := pathExists(kubeServiceAccountToken); e {
+			kc.tokenFile = kubeServiceAccountToken
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+
+	caCert := cfg.CACert
+	if caCert == "" {
+		if e, _ := pathExists(kubeServiceAccountCA); e {
+			caCert = kubeServiceAccountCA
+		}
+	}
+
+	if caCert != "" && !cfg.Insecure {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading Kubernetes CA cert: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in Kubernetes CA cert: %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	kc.httpClient = &http.Client{Transport: transport, Timeout: kubeRequestTimeout}
+	kc.streamClient = &http.Client{Transport: transport}
+	return kc, nil
+}
+
+// podNamespace returns the configured namespace or the namespace we are running in
+func podNamespace(cfg *config.KubernetesConfig) string {
+	if cfg.PodNamespace != "" {
+		return cfg.PodNamespace
+	}
+	if b, err := ioutil.ReadFile(kubeServiceAccountNS); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	return "default"
+}
+
+// resourcePath builds the API path for a core/v1 resource optionally scoped to a namespace
+func resourcePath(namespace, resource string) string {
+	if namespace == "" {
+		return "/api/v1/" + resource
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/%s", namespace, resource)
+}
+
+func (kc *kubeClient) listServices(namespace, selector string) (*kubeServiceList, error) {
+	list := &kubeServiceList{}
+	err := kc.get(resourcePath(namespace, "services"), listQuery(selector), list)
+	return list, err
+}
+
+func (kc *kubeClient) listEndpoints(namespace string) (*kubeEndpointsList, error) {
+	list := &kubeEndpointsList{}
+	err := kc.get(resourcePath(namespace, "endpoints"), url.Values{}, list)
+	return list, err
+}
+
+func (kc *kubeClient) listPods(namespace, selector string) (*kubePodList, error) {
+	list := &kubePodList{}
+	err := kc.get(resourcePath(namespace, "pods"), listQuery(selector), list)
+	return list, err
+}
+
+// watch streams change events for the resource starting after resourceVersion.  handler is
+// invoked for every event (excluding bookmarks) and the last seen resource version is
+// returned once the stream ends, errors or the context is cancelled.
+func (kc *kubeClient) watch(ctx context.Context, path, selector, resourceVersion string, handler func(eventType string, meta kubeObjectMeta)) (string, error) {
+	q := listQuery(selector)
+	q.Set("watch", "true")
+	q.Set("allowWatchBookmarks", "true")
+	if resourceVersion != "" {
+		q.Set("resourceVersion", resourceVersion)
+	}
+
+	req, err := kc.newRequest(path, q)
+	if err != nil {
+		return resourceVersion, err
+	}
+
+	resp, err := kc.streamClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return "", ErrWatchExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resourceVersion, fmt.Errorf("Kubernetes watch %s returned status: %d", path, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		event := kubeWatchEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			return resourceVersion, err
+		}
+
+		if event.Type == "ERROR" {
+			status := kubeStatus{}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return "", ErrWatchExpired
+			}
+			return resourceVersion, fmt.Errorf("Kubernetes watch error: %s", status.Message)
+		}
+
+		obj := struct {
+			Metadata kubeObjectMeta `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(event.Object, &obj); err != nil {
+			return resourceVersion, err
+		}
+
+		if obj.Metadata.ResourceVersion != "" {
+			resourceVersion = obj.Metadata.ResourceVersion
+		}
+
+		if event.Type != "BOOKMARK" {
+			handler(event.Type, obj.Metadata)
+		}
+	}
+}
+
+func (kc *kubeClient) get(path string, query url.Values, result interface{}) error {
+	req, err := kc.newRequest(path, query)
+	if err != nil {
+		return err
+	}
+
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		status := kubeStatus{}
+		json.NewDecoder(resp.Body).Decode(&status)
+		return fmt.Errorf("Kubernetes API %s returned status: %d %s", path, resp.StatusCode, status.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (kc *kubeClient) newRequest(path string, query url.Values) (*http.Request, error) {
+	uri := kc.endpoint + path
+	if len(query) > 0 {
+		uri = uri + "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := kc.token
+	if token == "" && kc.tokenFile != "" {
+		b, err := ioutil.ReadFile(kc.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading Kubernetes token: %s", err.Error())
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func listQuery(selector string) url.Values {
+	q := url.Values{}
+	if selector != "" {
+		q.Set("labelSelector", selector)
+	}
+	return q
+}
@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	kubeServicesFixture = `{
+  "kind": "ServiceList",
+  "metadata": {"resourceVersion": "100"},
+  "items": [
+    {
+      "metadata": {"name": "web", "namespace": "default", "labels": {"app": "web"}, "annotations": {"BT_VHOST": "web.example.com"}},
+      "spec": {"type": "ClusterIP", "clusterIP": "10.0.0.10", "ports": [
+        {"name": "http", "protocol": "TCP", "port": 80},
+        {"name": "metrics", "protocol": "TCP", "port": 9090}
+      ]}
+    },
+    {
+      "metadata": {"name": "idle", "namespace": "default"},
+      "spec": {"type": "ClusterIP", "ports": [{"name": "http", "port": 80}]}
+    },
+    {
+      "metadata": {"name": "external", "namespace": "default"},
+      "spec": {"type": "ExternalName"}
+    }
+  ]
+}`
+
+	kubeEndpointsFixture = `{
+  "kind": "EndpointsList",
+  "metadata": {"resourceVersion": "101"},
+  "items": [
+    {
+      "metadata": {"name": "web", "namespace": "default"},
+      "subsets": [{
+        "addresses": [{"ip": "172.16.0.5"}, {"ip": "172.16.0.4"}],
+        "notReadyAddresses": [{"ip": "172.16.0.9"}],
+        "ports": [{"name": "metrics", "port": 9100}, {"name": "http", "port": 8080}]
+      }]
+    },
+    {
+      "metadata": {"name": "idle", "namespace": "default"},
+      "subsets": []
+    }
+  ]
+}`
+
+	kubePodsFixture = `{
+  "kind": "PodList",
+  "metadata": {"resourceVersion": "102"},
+  "items": [
+    {"metadata": {"name": "bt-1", "namespace": "lb"}, "status": {"phase": "Running", "podIP": "172.16.1.1"}},
+    {"metadata": {"name": "bt-2", "namespace": "lb"}, "status": {"phase": "Pending"}}
+  ]
+}`
+
+	kubeWatchFixture = `{"type": "MODIFIED", "object": {"kind": "Endpoints", "metadata": {"name": "web", "namespace": "default", "resourceVersion": "103"}}}
+`
+)
+
+func newFakeKubeAPIServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("watch") == "true" {
+			if r.URL.Path == "/api/v1/namespaces/default/endpoints" {
+				fmt.Fprint(w, kubeWatchFixture)
+			}
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/namespaces/default/services":
+			fmt.Fprint(w, kubeServicesFixture)
+		case "/api/v1/namespaces/default/endpoints":
+			fmt.Fprint(w, kubeEndpointsFixture)
+		case "/api/v1/namespaces/lb/pods":
+			if r.URL.Query().Get("labelSelector") != "app=beethoven" {
+				t.Errorf("Unexpected pod selector: %s", r.URL.Query().Get("labelSelector"))
+			}
+			fmt.Fprint(w, kubePodsFixture)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestKubernetesScheduler(endpoint string) *kubernetesService {
+	cfg := &config.Config{
+		Port: 7777,
+		Kubernetes: &config.KubernetesConfig{
+			Endpoint:     endpoint,
+			Namespace:    "default",
+			Token:        "secret",
+			PodNamespace: "lb",
+			PodSelector:  "app=beethoven",
+		},
+	}
+	ss := &schedulerService{cfg: cfg, tracker: tracker.New(cfg)}
+	return createKubernetesScheduler(ss).(*kubernetesService)
+}
+
+func TestKubernetesFetchApps(t *testing.T) {
+	server := newFakeKubeAPIServer(t)
+	defer server.Close()
+
+	apps, err := newTestKubernetesScheduler(server.URL).FetchApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apps) != 1 {
+		t.Fatalf("Expected only services with ready endpoints, got %d apps", len(apps))
+	}
+
+	app := apps["default-web"]
+	if app == nil {
+		t.Fatal("Expected app default-web")
+	}
+
+	if app.Labels["app"] != "web" || app.Labels["BT_VHOST"] != "web.example.com" {
+		t.Errorf("Expected labels and annotations to be mapped, got %v", app.Labels)
+	}
+
+	if len(app.Tasks) != 2 {
+		t.Fatalf("Expected 2 ready tasks, got %d", len(app.Tasks))
+	}
+
+	task := app.Tasks[0]
+	if task.Host != "172.16.0.4" {
+		t.Errorf("Expected tasks sorted by host, got %s", task.Host)
+	}
+
+	if len(task.Ports) != 2 || task.Ports[0] != 8080 || task.Ports[1] != 9100 {
+		t.Errorf("Expected ports in service order, got %v", task.Ports)
+	}
+
+	if len(task.ServicePorts) != 2 || task.ServicePorts[0] != 80 || task.ServicePorts[1] != 9090 {
+		t.Errorf("Expected service ports in service order, got %v", task.ServicePorts)
+	}
+
+	if metrics, found := task.NamedPorts["metrics"]; !found || metrics.Port != 9100 || metrics.Protocol != "tcp" {
+		t.Errorf("Expected named metrics port, got %v", task.NamedPorts)
+	}
+}
+
+func TestKubernetesFetchBeethovenInstances(t *testing.T) {
+	server := newFakeKubeAPIServer(t)
+	defer server.Close()
+
+	instances, err := newTestKubernetesScheduler(server.URL).FetchBeethovenInstances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 1 {
+		t.Fatalf("Expected 1 running instance, got %d", len(instances))
+	}
+
+	if instances[0].Host != "172.16.1.1" || instances[0].Port != 7777 {
+		t.Errorf("Unexpected instance: %v", instances[0])
+	}
+}
+
+func TestKubernetesWatchTriggersReload(t *testing.T) {
+	server := newFakeKubeAPIServer(t)
+	defer server.Close()
+
+	k := newTestKubernetesScheduler(server.URL)
+	reload := make(chan bool, 2)
+	k.Watch(reload)
+	defer k.Shutdown()
+
+	// initial reload
+	<-reload
+
+	select {
+	case <-reload:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected watch event to trigger a reload")
+	}
+}
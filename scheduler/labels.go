@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// LabelVHost is a comma separated list of virtual hosts routed to the app
+	LabelVHost = "BT_VHOST"
+
+	// LabelPath is the path prefix routed to the app
+	LabelPath = "BT_PATH"
+
+	// LabelPortIndex selects which task port receives traffic.  Default: 0
+	LabelPortIndex = "BT_PORT_INDEX"
+
+	// LabelTLS serves the virtual hosts of the app over TLS when "true"
+	LabelTLS = "BT_TLS"
+
+	// LabelStripPrefix removes the path prefix before proxying to the app when "true"
+	LabelStripPrefix = "BT_STRIP_PREFIX"
+
+	// LabelTemplate selects the snippet template the app is rendered with
+	LabelTemplate = "BT_TEMPLATE"
+)
+
+// VHosts returns the virtual hosts declared by the LabelVHost label
+func (a *App) VHosts() []string {
+	vhosts := []string{}
+	for _, vhost := range strings.Split(a.Labels[LabelVHost], ",") {
+		if vhost = strings.TrimSpace(vhost); vhost != "" {
+			vhosts = append(vhosts, vhost)
+		}
+	}
+	return vhosts
+}
+
+// Path returns the path prefix declared by the LabelPath label
+func (a *App) Path() string {
+	return strings.TrimSpace(a.Labels[LabelPath])
+}
+
+// TLS determines if the app is served over TLS according to the LabelTLS label
+func (a *App) TLS() bool {
+	return a.boolLabel(LabelTLS)
+}
+
+// StripPrefix determines if the path prefix is removed according to the LabelStripPrefix label
+func (a *App) StripPrefix() bool {
+	return a.boolLabel(LabelStripPrefix)
+}
+
+func (a *App) boolLabel(label string) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(a.Labels[label]))
+	return b
+}
+
+// PortIndex returns the task port index declared by the LabelPortIndex label
+func (a *App) PortIndex() int {
+	if index, err := strconv.Atoi(a.Labels[LabelPortIndex]); err == nil && index >= 0 {
+		return index
+	}
+	return 0
+}
+
+// TemplateName returns the snippet template selected by the LabelTemplate label
+func (a *App) TemplateName() string {
+	return strings.TrimSpace(a.Labels[LabelTemplate])
+}
@@ -1,18 +1,22 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
-	"github.com/ContainX/depcon/marathon"
-	"github.com/ContainX/depcon/pkg/logger"
 	"strings"
+	"sync"
 	"time"
 )
 
 type marathonService struct {
 	*schedulerService
-	events   marathon.EventsChannel
-	marathon marathon.Marathon
-	shutdown ShutdownChan
+	endpoints *marathonEndpoints
+	shutdown  ShutdownChan
+
+	// endpoint the event stream is currently attached to and a func to detach it
+	sseLock     sync.Mutex
+	sseEndpoint *marathonEndpoint
+	sseCancel   context.CancelFunc
 }
 
 func createMarathonScheduler(ss *schedulerService) Scheduler {
@@ -22,28 +26,36 @@ func createMarathonScheduler(ss *schedulerService) Scheduler {
 // Watch for changes using streams and make callbacks to the specified
 // handler when apps have been added, removed or health changes.
 func (m *marathonService) Watch(reload chan bool) {
-	m.shutdown = make(ShutdownChan, 2)
+	m.shutdown = make(ShutdownChan)
 	m.reload = reload
 
-	// MVP - no health checks - should verify and use healthy masters
-	m.marathon = marathon.NewMarathonClient(m.cfg.Marathon.Endpoints[0], m.cfg.Marathon.Username, m.cfg.Marathon.Password, "")
-
-	// suppress marathon debug
-	logger.SetLevel(logger.WARNING, "client")
-	logger.SetLevel(logger.WARNING, "depcon.marathon")
+	m.endpoints = newMarathonEndpoints(m.cfg.Marathon)
+	if _, err := m.endpoints.refresh(); err != nil {
+		log.Errorf("Error electing Marathon endpoint: %s", err.Error())
+	}
 
-	m.initSSEStream()
-	m.reload <- true
+	go m.streamListener()
+	go m.monitorEndpoints()
+	m.triggerReload()
 }
 
 // Shutdown the current stream watching
 func (m *marathonService) Shutdown() {
-	m.shutdown <- true
+	close(m.shutdown)
+
+	m.sseLock.Lock()
+	if m.sseCancel != nil {
+		m.sseCancel()
+	}
+	m.sseLock.Unlock()
 }
 
 // Fetch all applications/services from the scheduler source
 func (m *marathonService) FetchApps() (map[string]*App, error) {
-	apps, err := m.marathon.ListApplicationsWithFilters("embed=apps.tasks")
+	apps := &marathonApps{}
+	err := m.withEndpoint(func(ep *marathonEndpoint) error {
+		return m.endpoints.getJSON(ep, "/v2/apps?embed=apps.tasks", apps)
+	})
 	if err != nil {
 		log.Errorf("Error fetching apps: %s", err.Error())
 		return nil, err
@@ -56,15 +68,38 @@ func (m *marathonService) FetchApps() (map[string]*App, error) {
 		// Create template based app
 		tapp := new(App)
 		tapp.AppId = appIdToDashes(a.ID)
-		tapp.Env = a.Env
+		tapp.Id = a.ID
+		tapp.Instances = a.Instances
+		tapp.HealthChecks = a.healthChecks()
+		tapp.PortDefinitions = a.portDefinitions()
+		tapp.IpPerTask = a.ipPerTask()
+		tapp.Env = a.envVars()
 		tapp.Labels = a.Labels
 		tapp.Tasks = []Task{}
+		tapp.IpTasks = []Task{}
+
+		if tapp.Labels == nil {
+			tapp.Labels = map[string]string{}
+		}
+
+		descriptors := a.portDescriptors()
+		discoveryPorts := a.discoveryPorts()
 
 		// Iterate through the apps tasks - remove any tasks that do not match
 		// our criteria for being healthy
 		for _, t := range a.Tasks {
+			task := marathonTaskToTask(t, descriptors)
+
+			// IP-per-task without host ports - the container ports are only reachable on
+			// the task address so these are kept out of Tasks
+			ipTask := len(task.Ports) == 0 && len(task.IpAddresses) > 0
+			if ipTask {
+				task.Host = task.IpAddresses[0].IpAddress
+				task.setPortMappings(discoveryPorts)
+			}
+
 			// Skip tasks with no ports
-			if len(t.Ports) == 0 {
+			if len(task.Ports) == 0 {
 				continue
 			}
 
@@ -87,11 +122,15 @@ func (m *marathonService) FetchApps() (map[string]*App, error) {
 					continue
 				}
 			}
-			tapp.Tasks = append(tapp.Tasks, marathonTaskToTask(t))
+			if ipTask {
+				tapp.IpTasks = append(tapp.IpTasks, task)
+			} else {
+				tapp.Tasks = append(tapp.Tasks, task)
+			}
 		}
 
 		// Only add apps with tasks
-		if len(tapp.Tasks) > 0 {
+		if len(tapp.Tasks) > 0 || len(tapp.IpTasks) > 0 {
 			result[tapp.AppId] = tapp
 		}
 
@@ -105,11 +144,18 @@ func (m *marathonService) FetchBeethovenInstances() ([]*BeethovenInstance, error
 		return nil, fmt.Errorf("Marathon Service Identifier must be specified in the configuration")
 	}
 
-	if app, err := m.marathon.GetApplication(m.cfg.Marathon.ServiceId); err != nil {
+	resp := &marathonAppResponse{}
+	err := m.withEndpoint(func(ep *marathonEndpoint) error {
+		return m.endpoints.getJSON(ep, "/v2/apps/"+strings.TrimPrefix(m.cfg.Marathon.ServiceId, "/")+"?embed=app.tasks", resp)
+	})
+
+	if err != nil {
 		return nil, err
+	} else if resp.App == nil {
+		return nil, fmt.Errorf("Marathon app not found: %s", m.cfg.Marathon.ServiceId)
 	} else {
 		instances := []*BeethovenInstance{}
-		for _, task := range app.Tasks {
+		for _, task := range resp.App.Tasks {
 			if len(task.Ports) > 0 {
 				instances = append(instances, &BeethovenInstance{Host: task.Host, Port: task.Ports[0]})
 			}
@@ -118,79 +164,206 @@ func (m *marathonService) FetchBeethovenInstances() ([]*BeethovenInstance, error
 	}
 }
 
-func (m *marathonService) initSSEStream() {
-	m.events = make(marathon.EventsChannel, 5)
+// withEndpoint invokes fn with the active endpoint.  If the call fails
+// we fail over to the next healthy endpoint and try again until all endpoints have
+// been exhausted
+func (m *marathonService) withEndpoint(fn func(ep *marathonEndpoint) error) error {
+	ep := m.endpoints.current()
+	if ep == nil {
+		if _, err := m.endpoints.refresh(); err != nil {
+			return err
+		}
+		ep = m.endpoints.current()
+	}
+
+	var err error
+	for attempt := 0; attempt < m.endpoints.size() && ep != nil; attempt++ {
+		if err = fn(ep); err == nil {
+			return nil
+		}
+		log.Warningf("Request to Marathon endpoint %s failed: %s", ep.url, err.Error())
 
-	filter := marathon.EventIDStatusUpdate | marathon.EventIDChangedHealthCheck
+		next, ferr := m.endpoints.failover(ep)
+		if ferr != nil {
+			return err
+		}
+		if next != ep {
+			m.switchEventStream()
+		}
+		ep = next
+	}
+	return err
+}
 
-	err := m.marathon.CreateEventStreamListener(m.events, filter)
-	if err != nil {
-		log.Fatalf("Failed to register for events, %s", err)
+// monitorEndpoints periodically health checks all Marathon endpoints.  When the active
+// endpoint changes the event stream is moved to the new endpoint
+func (m *marathonService) monitorEndpoints() {
+	interval := MarathonHealthCheckSec * time.Second
+	if m.cfg.Marathon.HealthCheckIntervalSecs > 0 {
+		interval = time.Duration(m.cfg.Marathon.HealthCheckIntervalSecs) * time.Second
 	}
 
-	go m.streamListener()
-}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-func (m *marathonService) streamListener() {
-	stop := false
 	for {
-		if stop {
-			break
-		}
 		select {
-		case <-m.shutdown:
-			stop = true
-		case event := <-m.events:
-			{
-				// If the event doesn't contain the AppId -- skip
-				appId := m.getAppID(event)
-				if m.shouldTriggerReload(appId, event) {
-					select {
-					case m.reload <- true:
-					default:
-						log.Warning("Reload queue is full")
-					}
-				}
+		case <-ticker.C:
+			changed, err := m.endpoints.refresh()
+			if err != nil {
+				log.Errorf("Marathon health check: %s", err.Error())
+			}
+			if changed {
+				m.switchEventStream()
 			}
+		case <-m.shutdown:
+			return
 		}
 	}
-	m.marathon.CloseEventStreamListener(m.events)
 }
 
-// getAppID returns the application indentifier for only the evens we care to
-// trigger a configuration reload from.
-func (m *marathonService) getAppID(e *marathon.Event) string {
-	switch e.ID {
-	case marathon.EventIDStatusUpdate:
-		return toEventStatusUpdate(e).AppID
-	case marathon.EventIDAPIRequest:
-		return toEventAPIRequest(e).AppDefinition.ID
-	case marathon.EventIDChangedHealthCheck:
-		return toEventHealthCheckChanged(e).AppID
-	}
-	return ""
+// switchEventStream detaches the event stream if it is not attached to the active
+// endpoint.  The stream listener will then reconnect to the active endpoint
+func (m *marathonService) switchEventStream() {
+	m.sseLock.Lock()
+	defer m.sseLock.Unlock()
+
+	if m.sseCancel != nil && m.sseEndpoint != m.endpoints.current() {
+		log.Infof("Moving event stream off of Marathon endpoint: %s", m.sseEndpoint.url)
+		m.sseCancel()
+	}
 }
 
-func toEventStatusUpdate(e *marathon.Event) *marathon.EventStatusUpdate {
-	return e.Event.(*marathon.EventStatusUpdate)
+// streamListener keeps the event stream (SSE) attached to the active endpoint.  When
+// the stream drops we reconnect using an exponential backoff with jitter and trigger a
+// full resync once connected, since events may have been missed in the meantime.  An
+// established stream ending (idle timeouts, proxies, leader changes) is not a failure
+// of the endpoint, we only fail over when attaching to it fails
+func (m *marathonService) streamListener() {
+	maxDelay := MarathonMaxReconnectDelaySec * time.Second
+	if m.cfg.Marathon.MaxReconnectDelaySecs > 0 {
+		maxDelay = time.Duration(m.cfg.Marathon.MaxReconnectDelaySecs) * time.Second
+	}
+
+	attempts := 0
+	connectedOnce := false
+
+	for {
+		ep := m.endpoints.current()
+		if ep == nil {
+			m.endpoints.refresh()
+			ep = m.endpoints.current()
+		}
+
+		var err error
+		switched := false
+		established := false
+
+		if ep == nil {
+			err = ErrNoHealthyEndpoints
+		} else {
+			ctx, cancel := context.WithCancel(context.Background())
+			m.sseLock.Lock()
+			m.sseEndpoint = ep
+			m.sseCancel = cancel
+			m.sseLock.Unlock()
+
+			err = m.endpoints.streamEvents(ctx, ep, func() {
+				log.Infof("Listening for events from Marathon endpoint: %s", ep.url)
+				attempts = 0
+				established = true
+				m.tracker.SetEventStreamConnected(marathonStreamSource, ep.url)
+				if connectedOnce {
+					log.Info("Event stream reconnected, triggering full resync")
+					m.triggerReload()
+				}
+				connectedOnce = true
+			}, m.handleEvent)
+
+			switched = ctx.Err() != nil
+			cancel()
+
+			m.sseLock.Lock()
+			m.sseEndpoint = nil
+			m.sseCancel = nil
+			m.sseLock.Unlock()
+		}
+
+		select {
+		case <-m.shutdown:
+			m.tracker.SetEventStreamDisconnected(marathonStreamSource)
+			return
+		default:
+		}
+
+		if switched {
+			// detached intentionally - reconnect to the new active endpoint immediately
+			continue
+		}
+
+		attempts++
+		if established {
+			log.Warningf("Event stream from Marathon endpoint %s ended: %s", ep.url, err.Error())
+		} else if ep != nil {
+			log.Errorf("Event stream from Marathon endpoint %s failed: %s", ep.url, err.Error())
+			m.endpoints.failover(ep)
+		} else {
+			log.Errorf("Unable to attach event stream: %s", err.Error())
+		}
+
+		delay := reconnectDelay(attempts, maxDelay)
+		log.Infof("Reconnecting event stream in %s (attempt %d)", delay, attempts)
+		m.tracker.SetEventStreamReconnecting(marathonStreamSource, attempts)
+
+		select {
+		case <-time.After(delay):
+		case <-m.shutdown:
+			m.tracker.SetEventStreamDisconnected(marathonStreamSource)
+			return
+		}
+	}
 }
 
-func toEventAPIRequest(e *marathon.Event) *marathon.EventAPIRequest {
-	return e.Event.(*marathon.EventAPIRequest)
+// handleEvent triggers a reload for events that pass the configured filter
+func (m *marathonService) handleEvent(event *marathonEvent) {
+	m.tracker.SetLastEvent(time.Now())
+	if m.shouldTriggerReload(event.AppID, event) {
+		m.triggerReload()
+	}
 }
 
-func toEventHealthCheckChanged(e *marathon.Event) *marathon.EventHealthCheckChanged {
-	return e.Event.(*marathon.EventHealthCheckChanged)
+func (m *marathonService) triggerReload() {
+	select {
+	case m.reload <- true:
+	default:
+		log.Warning("Reload queue is full")
+	}
 }
 
-func marathonTaskToTask(mt *marathon.Task) Task {
+// marathonTaskToTask maps a Marathon task to a Task naming its ports using the
+// descriptors declared by the app, matched by index
+func marathonTaskToTask(mt *marathonTask, descriptors []PortMapping) Task {
+	mappings := portMappings(mt.Ports, mt.ServicePorts)
+	for i := range mappings {
+		if i < len(descriptors) {
+			mappings[i].Name = descriptors[i].Name
+			mappings[i].Protocol = descriptors[i].Protocol
+		}
+	}
+
 	task := Task{}
+	task.Id = mt.ID
+	task.AppId = mt.AppID
+	task.SlaveId = mt.SlaveID
 	task.Host = mt.Host
-	task.Ports = mt.Ports
-	task.ServicePorts = mt.ServicePorts
+	task.setPortMappings(mappings)
 	task.StagedAt = mt.StagedAt
-	task.StartedAt = mt.StagedAt
+	task.StartedAt = mt.StartedAt
 	task.Version = mt.Version
+	task.IpAddresses = []IpAddress{}
+	for _, ip := range mt.IPAddresses {
+		task.IpAddresses = append(task.IpAddresses, IpAddress{IpAddress: ip.IPAddress, Protocol: ip.Protocol})
+	}
 	return task
 }
 
@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MarathonHealthCheckSec is the default interval when health checking Marathon endpoints
+	MarathonHealthCheckSec = 10
+
+	// marathonRequestTimeout is the timeout used for endpoint health checks
+	marathonRequestTimeout = 5 * time.Second
+
+	// marathonAPITimeout is the timeout used when fetching apps which may be large
+	marathonAPITimeout = 30 * time.Second
+)
+
+var (
+	ErrNoHealthyEndpoints = errors.New("No healthy Marathon endpoints available")
+)
+
+// marathonEndpoint is a single configured Marathon master
+type marathonEndpoint struct {
+	url     string
+	host    string
+	healthy bool
+}
+
+// marathonEndpoints tracks the health of all configured Marathon masters and
+// which one is currently active
+type marathonEndpoints struct {
+	sync.RWMutex
+	endpoints  []*marathonEndpoint
+	active     *marathonEndpoint
+	username   string
+	password   string
+	httpClient *http.Client
+	apiClient  *http.Client
+
+	// client used for long lived event streams (no timeout)
+	streamClient *http.Client
+}
+
+type marathonLeader struct {
+	Leader string `json:"leader"`
+}
+
+func newMarathonEndpoints(cfg *config.MarathonConfig) *marathonEndpoints {
+	me := &marathonEndpoints{
+		endpoints:  []*marathonEndpoint{},
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: &http.Client{Timeout: marathonRequestTimeout},
+		apiClient:  &http.Client{Timeout: marathonAPITimeout},
+
+		streamClient: &http.Client{},
+	}
+
+	for _, endpoint := range cfg.Endpoints {
+		endpoint = strings.TrimRight(endpoint, "/")
+		host := endpoint
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		me.endpoints = append(me.endpoints, &marathonEndpoint{
+			url:     endpoint,
+			host:    host,
+			healthy: true,
+		})
+	}
+	return me
+}
+
+// current returns the active endpoint or nil if one has not been elected
+func (me *marathonEndpoints) current() *marathonEndpoint {
+	me.RLock()
+	defer me.RUnlock()
+	return me.active
+}
+
+// size is the number of configured endpoints
+func (me *marathonEndpoints) size() int {
+	return len(me.endpoints)
+}
+
+// refresh health checks every endpoint and elects the active one.  The reported leader
+// is preferred, followed by the currently active endpoint and finally the first healthy one.
+// Returns true if the active endpoint has changed
+func (me *marathonEndpoints) refresh() (bool, error) {
+	healthy := make([]bool, len(me.endpoints))
+	leader := ""
+
+	for i, ep := range me.endpoints {
+		healthy[i] = me.ping(ep)
+		if healthy[i] && leader == "" {
+			leader = me.leader(ep)
+		}
+	}
+
+	me.Lock()
+	defer me.Unlock()
+
+	previous := me.active
+	var elected *marathonEndpoint
+
+	for i, ep := range me.endpoints {
+		if ep.healthy != healthy[i] {
+			log.Infof("Marathon endpoint %s healthy: %v", ep.url, healthy[i])
+		}
+		ep.healthy = healthy[i]
+		if ep.healthy && leader != "" && ep.host == leader {
+			elected = ep
+		}
+	}
+
+	if elected == nil && previous != nil && previous.healthy {
+		elected = previous
+	}
+
+	if elected == nil {
+		for _, ep := range me.endpoints {
+			if ep.healthy {
+				elected = ep
+				break
+			}
+		}
+	}
+
+	me.active = elected
+	if elected == nil {
+		return previous != nil, ErrNoHealthyEndpoints
+	}
+
+	if elected != previous {
+		log.Infof("Using Marathon endpoint: %s", elected.url)
+		return true, nil
+	}
+	return false, nil
+}
+
+// failover marks the specified endpoint as unhealthy and elects the next healthy
+// endpoint in configuration order.  The failed endpoint will be re-evaluated on the
+// next refresh
+func (me *marathonEndpoints) failover(failed *marathonEndpoint) (*marathonEndpoint, error) {
+	me.Lock()
+	defer me.Unlock()
+
+	if failed != nil {
+		failed.healthy = false
+	}
+
+	if me.active != failed && me.active != nil && me.active.healthy {
+		return me.active, nil
+	}
+
+	start := 0
+	for i, ep := range me.endpoints {
+		if ep == failed {
+			start = i + 1
+			break
+		}
+	}
+
+	for i := 0; i < len(me.endpoints); i++ {
+		ep := me.endpoints[(start+i)%len(me.endpoints)]
+		if ep.healthy {
+			log.Warningf("Failing over to Marathon endpoint: %s", ep.url)
+			me.active = ep
+			return ep, nil
+		}
+	}
+	me.active = nil
+	return nil, ErrNoHealthyEndpoints
+}
+
+// ping determines whether the endpoint is up and able to serve requests
+func (me *marathonEndpoints) ping(ep *marathonEndpoint) bool {
+	resp, err := me.get(ep, "/ping")
+	if err != nil {
+		log.Debugf("Marathon endpoint %s failed health check: %s", ep.url, err.Error())
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// leader asks the endpoint for the current leading master in host:port form
+func (me *marathonEndpoints) leader(ep *marathonEndpoint) string {
+	resp, err := me.get(ep, "/v2/leader")
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	l := marathonLeader{}
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return ""
+	}
+	return l.Leader
+}
+
+// getJSON performs a GET against the Marathon API of the endpoint decoding the
+// response into result
+func (me *marathonEndpoints) getJSON(ep *marathonEndpoint, path string, result interface{}) error {
+	resp, err := me.do(me.apiClient, ep, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Marathon API %s returned status: %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (me *marathonEndpoints) get(ep *marathonEndpoint, path string) (*http.Response, error) {
+	return me.do(me.httpClient, ep, path)
+}
+
+func (me *marathonEndpoints) do(client *http.Client, ep *marathonEndpoint, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, ep.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if me.username != "" {
+		req.SetBasicAuth(me.username, me.password)
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newMarathonMaster(leader *string, up *bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !*up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/ping":
+			fmt.Fprint(w, "pong")
+		case "/v2/leader":
+			fmt.Fprintf(w, `{"leader": "%s"}`, *leader)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMarathonEndpointsPrefersLeader(t *testing.T) {
+	leader := ""
+	up1, up2 := true, true
+	m1 := newMarathonMaster(&leader, &up1)
+	defer m1.Close()
+	m2 := newMarathonMaster(&leader, &up2)
+	defer m2.Close()
+
+	leader = strings.TrimPrefix(m2.URL, "http://")
+
+	me := newMarathonEndpoints(&config.MarathonConfig{Endpoints: []string{m1.URL, m2.URL}})
+	changed, err := me.refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Expected active endpoint to change on first refresh")
+	}
+	if me.current().url != m2.URL {
+		t.Errorf("Expected leader %s to be active, got %s", m2.URL, me.current().url)
+	}
+}
+
+func TestMarathonEndpointsFailover(t *testing.T) {
+	leader := ""
+	up1, up2 := true, true
+	m1 := newMarathonMaster(&leader, &up1)
+	defer m1.Close()
+	m2 := newMarathonMaster(&leader, &up2)
+	defer m2.Close()
+
+	me := newMarathonEndpoints(&config.MarathonConfig{Endpoints: []string{m1.URL, m2.URL}})
+	if _, err := me.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if me.current().url != m1.URL {
+		t.Fatalf("Expected first healthy endpoint to be active, got %s", me.current().url)
+	}
+
+	next, err := me.failover(me.current())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.url != m2.URL {
+		t.Errorf("Expected failover to %s, got %s", m2.URL, next.url)
+	}
+
+	// Both down - nothing left to elect
+	up1, up2 = false, false
+	if _, err := me.refresh(); err != ErrNoHealthyEndpoints {
+		t.Errorf("Expected ErrNoHealthyEndpoints, got %v", err)
+	}
+	if me.current() != nil {
+		t.Error("Expected no active endpoint")
+	}
+
+	// First comes back
+	up1 = true
+	changed, err := me.refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || me.current().url != m1.URL {
+		t.Error("Expected recovered endpoint to become active")
+	}
+}
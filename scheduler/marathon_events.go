@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	marathonEventStatusUpdate        = "status_update_event"
+	marathonEventHealthStatusChanged = "health_status_changed_event"
+
+	// marathonStreamSource names the event stream in the tracker
+	marathonStreamSource = "marathon"
+
+	// MarathonMaxReconnectDelaySec is the default upper bound between event stream reconnects
+	MarathonMaxReconnectDelaySec = 60
+
+	// marathonMinReconnectDelay is the delay before the first reconnect attempt
+	marathonMinReconnectDelay = 1 * time.Second
+)
+
+var (
+	ErrEventStreamClosed = errors.New("Marathon event stream closed")
+)
+
+// marathonEvent is the subset of a Marathon event used to decide if a
+// reload is required
+type marathonEvent struct {
+	EventType string `json:"eventType"`
+	AppID     string `json:"appId"`
+	TaskID    string `json:"taskId"`
+}
+
+func (e *marathonEvent) String() string {
+	return fmt.Sprintf("%s (app: %s, task: %s)", e.EventType, e.AppID, e.TaskID)
+}
+
+// streamEvents attaches to the event stream (SSE) of the specified endpoint and invokes
+// handler for each status update or health change event.  connected is invoked once the
+// stream has been established.  This call blocks until the stream ends, fails or
+// the context is cancelled.
+func (me *marathonEndpoints) streamEvents(ctx context.Context, ep *marathonEndpoint, connected func(), handler func(*marathonEvent)) error {
+	uri := fmt.Sprintf("%s/v2/events?event_type=%s&event_type=%s", ep.url, marathonEventStatusUpdate, marathonEventHealthStatusChanged)
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if me.username != "" {
+		req.SetBasicAuth(me.username, me.password)
+	}
+
+	resp, err := me.streamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Marathon event stream returned status: %d", resp.StatusCode)
+	}
+
+	connected()
+
+	eventType := ""
+	data := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// blank line dispatches the event
+			if len(data) > 0 {
+				dispatchMarathonEvent(eventType, strings.Join(data, "\n"), handler)
+			}
+			eventType = ""
+			data = data[:0]
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(line[len("data:"):]))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ErrEventStreamClosed
+}
+
+func dispatchMarathonEvent(eventType, data string, handler func(*marathonEvent)) {
+	if eventType != "" && eventType != marathonEventStatusUpdate && eventType != marathonEventHealthStatusChanged {
+		return
+	}
+
+	event := &marathonEvent{}
+	if err := json.Unmarshal([]byte(data), event); err != nil {
+		log.Warningf("Error decoding Marathon event: %s", err.Error())
+		return
+	}
+
+	if event.EventType == "" {
+		event.EventType = eventType
+	}
+
+	switch event.EventType {
+	case marathonEventStatusUpdate, marathonEventHealthStatusChanged:
+		handler(event)
+	}
+}
+
+// reconnectDelay is an exponential backoff with jitter based on the number of
+// failed attempts.  The result is between half and the full backoff value and never
+// exceeds max
+func reconnectDelay(attempt int, max time.Duration) time.Duration {
+	backoff := marathonMinReconnectDelay
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const sseFixture = `event: event_stream_attached
+data: {"remoteAddress":"127.0.0.1","eventType":"event_stream_attached"}
+
+: keep-alive
+
+event: status_update_event
+data: {"appId":"/products/stores","taskId":"t1","eventType":"status_update_event"}
+
+event: deployment_info
+data: {"eventType":"deployment_info"}
+
+event: health_status_changed_event
+data: {"appId":"/products/search","taskId":"t2","alive":false,"eventType":"health_status_changed_event"}
+
+`
+
+func TestStreamEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Error("Expected event-stream accept header")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, sseFixture)
+	}))
+	defer server.Close()
+
+	me := newMarathonEndpoints(&config.MarathonConfig{Endpoints: []string{server.URL}})
+
+	connected := false
+	events := []*marathonEvent{}
+
+	err := me.streamEvents(context.Background(), me.endpoints[0], func() {
+		connected = true
+	}, func(e *marathonEvent) {
+		events = append(events, e)
+	})
+
+	if err != ErrEventStreamClosed {
+		t.Errorf("Expected stream closed error, got: %v", err)
+	}
+
+	if !connected {
+		t.Error("Expected connected callback")
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if events[0].AppID != "/products/stores" || events[0].EventType != marathonEventStatusUpdate {
+		t.Errorf("Unexpected first event: %s", events[0])
+	}
+
+	if events[1].AppID != "/products/search" || events[1].EventType != marathonEventHealthStatusChanged {
+		t.Errorf("Unexpected second event: %s", events[1])
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	max := 10 * time.Second
+
+	for attempt := 1; attempt < 10; attempt++ {
+		d := reconnectDelay(attempt, max)
+		if d > max {
+			t.Errorf("Attempt %d: delay %s exceeds max %s", attempt, d, max)
+		}
+	}
+
+	if d := reconnectDelay(1, max); d < marathonMinReconnectDelay/2 || d > marathonMinReconnectDelay {
+		t.Errorf("First attempt delay out of range: %s", d)
+	}
+
+	if d := reconnectDelay(20, max); d < max/2 {
+		t.Errorf("Expected delay to be capped near max, got %s", d)
+	}
+}
+
+func TestStreamListenerKeepsEndpointWhenStreamEnds(t *testing.T) {
+	// both masters close the stream as soon as it is attached, like an idle timeout
+	newMaster := func(streams chan bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/ping":
+				fmt.Fprint(w, "pong")
+			case "/v2/events":
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, sseFixture)
+				streams <- true
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+
+	streams, otherStreams := make(chan bool, 10), make(chan bool, 10)
+	m1 := newMaster(streams)
+	defer m1.Close()
+	m2 := newMaster(otherStreams)
+	defer m2.Close()
+
+	cfg := &config.Config{Marathon: &config.MarathonConfig{Endpoints: []string{m1.URL, m2.URL}}}
+	m := createMarathonScheduler(&schedulerService{cfg: cfg, tracker: tracker.New(cfg), reload: make(chan bool, 10)}).(*marathonService)
+	m.shutdown = make(ShutdownChan)
+	m.endpoints = newMarathonEndpoints(cfg.Marathon)
+	if _, err := m.endpoints.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	go m.streamListener()
+	defer m.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-streams:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the event stream to reconnect to the same endpoint")
+		}
+	}
+
+	if len(otherStreams) != 0 || m.endpoints.current().url != m1.URL {
+		t.Errorf("Expected the stream to stay on %s, %d streams attached to %s", m1.URL, len(otherStreams), m2.URL)
+	}
+}
@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func newTestMarathonScheduler(t *testing.T) (*marathonService, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ping":
+			w.Write([]byte("pong"))
+		case "/v2/apps":
+			http.ServeFile(w, r, filepath.Join("fixtures", "marathon_apps.json"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	cfg := &config.Config{Marathon: &config.MarathonConfig{Endpoints: []string{server.URL}}}
+	m := createMarathonScheduler(&schedulerService{cfg: cfg, tracker: tracker.New(cfg)}).(*marathonService)
+	m.endpoints = newMarathonEndpoints(cfg.Marathon)
+	if _, err := m.endpoints.refresh(); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return m, server.Close
+}
+
+func TestMarathonFetchApps(t *testing.T) {
+	m, closer := newTestMarathonScheduler(t)
+	defer closer()
+
+	apps, err := m.FetchApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apps) != 3 {
+		t.Fatalf("Expected only apps with healthy tasks, got %d apps", len(apps))
+	}
+
+	web := apps["products-web"]
+	if web == nil {
+		t.Fatal("Expected app products-web")
+	}
+
+	if web.Id != "/products/web" || web.Instances != 2 {
+		t.Errorf("Expected original id and instances, got %s %d", web.Id, web.Instances)
+	}
+
+	if len(web.HealthChecks) != 1 || web.HealthChecks[0].Path != "/health" || web.HealthChecks[0].IntervalSeconds != 10 {
+		t.Errorf("Expected health check definitions, got %v", web.HealthChecks)
+	}
+
+	if len(web.PortDefinitions) != 2 || web.PortDefinitions[1].Labels["metrics"] != "prometheus" {
+		t.Errorf("Expected port definitions with labels, got %v", web.PortDefinitions)
+	}
+
+	if len(web.Env) != 1 || web.Env["STAGE"] != "prod" {
+		t.Errorf("Expected only string env vars, got %v", web.Env)
+	}
+
+	if len(web.Tasks) != 1 {
+		t.Fatalf("Expected tasks without health results to be skipped, got %d", len(web.Tasks))
+	}
+
+	task := web.Tasks[0]
+	if task.Id != "products_web.1" || task.AppId != "/products/web" || task.SlaveId != "agent-1" {
+		t.Errorf("Expected task identifiers, got %s %s %s", task.Id, task.AppId, task.SlaveId)
+	}
+
+	if task.StartedAt != "2017-01-01T00:00:05.000Z" {
+		t.Errorf("Expected started at, got %s", task.StartedAt)
+	}
+
+	metrics, found := web.Tasks[0].NamedPorts["metrics"]
+	if !found || metrics.Port != 31001 || metrics.ServicePort != 10001 || metrics.Protocol != "tcp" {
+		t.Errorf("Expected named port from port definitions, got %v", web.Tasks[0].NamedPorts)
+	}
+
+	search := apps["search"]
+	if search == nil || len(search.Tasks) != 1 {
+		t.Fatal("Expected app search with 1 task")
+	}
+
+	api := search.Tasks[0].PortMappings[0]
+	if api.Name != "api" || api.Protocol != "udp" || api.Port != 31004 || api.ServicePort != 10002 {
+		t.Errorf("Expected port named from docker port mappings, got %v", api)
+	}
+
+	overlay := apps["overlay-api"]
+	if overlay == nil || !overlay.IpPerTask || len(overlay.Tasks) != 0 || len(overlay.IpTasks) != 1 {
+		t.Fatal("Expected IP-per-task app overlay-api with 1 IP task and no host tasks")
+	}
+
+	if ipTask := overlay.IpTasks[0]; ipTask.Host != "192.168.0.10" || len(ipTask.IpAddresses) != 1 {
+		t.Errorf("Expected task ip address as host, got %v", ipTask)
+	}
+
+	if http, found := overlay.IpTasks[0].NamedPorts["http"]; !found || http.Port != 8080 {
+		t.Errorf("Expected discovery ports, got %v", overlay.IpTasks[0].NamedPorts)
+	}
+
+	if addresses := overlay.TaskAddresses(); len(addresses) != 1 || addresses[0] != "192.168.0.10:8080" {
+		t.Errorf("Expected task address on the container network, got %v", addresses)
+	}
+}
@@ -0,0 +1,193 @@
+package scheduler
+
+// marathonApps is the response of /v2/apps
+type marathonApps struct {
+	Apps []*marathonApp `json:"apps"`
+}
+
+// marathonAppResponse is the response of /v2/apps/{id}
+type marathonAppResponse struct {
+	App *marathonApp `json:"app"`
+}
+
+type marathonApp struct {
+	ID              string                    `json:"id"`
+	Env             map[string]interface{}    `json:"env"`
+	Labels          map[string]string         `json:"labels"`
+	Instances       int                       `json:"instances"`
+	HealthChecks    []*marathonHealthCheck    `json:"healthChecks"`
+	PortDefinitions []*marathonPortDefinition `json:"portDefinitions"`
+	Container       *marathonContainer        `json:"container"`
+	IPAddress       *marathonAppIPAddress     `json:"ipAddress"`
+	Tasks           []*marathonTask           `json:"tasks"`
+}
+
+type marathonHealthCheck struct {
+	Protocol               string `json:"protocol"`
+	Path                   string `json:"path"`
+	PortIndex              int    `json:"portIndex"`
+	Port                   int    `json:"port"`
+	GracePeriodSeconds     int    `json:"gracePeriodSeconds"`
+	IntervalSeconds        int    `json:"intervalSeconds"`
+	TimeoutSeconds         int    `json:"timeoutSeconds"`
+	MaxConsecutiveFailures int    `json:"maxConsecutiveFailures"`
+}
+
+type marathonPortDefinition struct {
+	Port     int               `json:"port"`
+	Protocol string            `json:"protocol"`
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels"`
+}
+
+type marathonAppIPAddress struct {
+	NetworkName string             `json:"networkName"`
+	Discovery   *marathonDiscovery `json:"discovery"`
+}
+
+type marathonDiscovery struct {
+	Ports []*marathonDiscoveryPort `json:"ports"`
+}
+
+type marathonDiscoveryPort struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+}
+
+type marathonContainer struct {
+	Docker       *marathonDocker        `json:"docker"`
+	PortMappings []*marathonPortMapping `json:"portMappings"`
+}
+
+type marathonDocker struct {
+	PortMappings []*marathonPortMapping `json:"portMappings"`
+}
+
+type marathonPortMapping struct {
+	ContainerPort int               `json:"containerPort"`
+	HostPort      int               `json:"hostPort"`
+	ServicePort   int               `json:"servicePort"`
+	Protocol      string            `json:"protocol"`
+	Name          string            `json:"name"`
+	Labels        map[string]string `json:"labels"`
+}
+
+type marathonTask struct {
+	ID                string                       `json:"id"`
+	AppID             string                       `json:"appId"`
+	SlaveID           string                       `json:"slaveId"`
+	Host              string                       `json:"host"`
+	Ports             []int                        `json:"ports"`
+	ServicePorts      []int                        `json:"servicePorts"`
+	StagedAt          string                       `json:"stagedAt"`
+	StartedAt         string                       `json:"startedAt"`
+	Version           string                       `json:"version"`
+	IPAddresses       []*marathonIPAddress         `json:"ipAddresses"`
+	HealthCheckResult []*marathonHealthCheckResult `json:"healthCheckResults"`
+}
+
+type marathonIPAddress struct {
+	IPAddress string `json:"ipAddress"`
+	Protocol  string `json:"protocol"`
+}
+
+type marathonHealthCheckResult struct {
+	Alive bool `json:"alive"`
+}
+
+// envVars returns the string environment variables of the app.  Secret references
+// are objects and are not exposed to templates
+func (a *marathonApp) envVars() map[string]string {
+	env := map[string]string{}
+	for k, v := range a.Env {
+		if s, ok := v.(string); ok {
+			env[k] = s
+		}
+	}
+	return env
+}
+
+func (a *marathonApp) healthChecks() []HealthCheck {
+	checks := []HealthCheck{}
+	for _, hc := range a.HealthChecks {
+		checks = append(checks, HealthCheck{
+			Protocol:               hc.Protocol,
+			Path:                   hc.Path,
+			PortIndex:              hc.PortIndex,
+			Port:                   hc.Port,
+			GracePeriodSeconds:     hc.GracePeriodSeconds,
+			IntervalSeconds:        hc.IntervalSeconds,
+			TimeoutSeconds:         hc.TimeoutSeconds,
+			MaxConsecutiveFailures: hc.MaxConsecutiveFailures,
+		})
+	}
+	return checks
+}
+
+func (a *marathonApp) portDefinitions() []PortDefinition {
+	definitions := []PortDefinition{}
+	for _, pd := range a.PortDefinitions {
+		labels := pd.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		definitions = append(definitions, PortDefinition{
+			Port:     pd.Port,
+			Protocol: normalizeProtocol(pd.Protocol),
+			Name:     pd.Name,
+			Labels:   labels,
+		})
+	}
+	return definitions
+}
+
+// ipPerTask determines if the app is assigned its own IP address per task
+func (a *marathonApp) ipPerTask() bool {
+	return a.IPAddress != nil
+}
+
+// discoveryPorts are the ports exposed on the task IP address when using IP-per-task
+func (a *marathonApp) discoveryPorts() []PortMapping {
+	ports := []PortMapping{}
+	if a.IPAddress == nil || a.IPAddress.Discovery == nil {
+		return ports
+	}
+
+	for _, dp := range a.IPAddress.Discovery.Ports {
+		ports = append(ports, PortMapping{
+			Name:     dp.Name,
+			Protocol: normalizeProtocol(dp.Protocol),
+			Port:     dp.Number,
+		})
+	}
+	return ports
+}
+
+// portDescriptors returns the declared name and protocol of each port in the order
+// Marathon assigns task ports.  Port definitions are used for host networking otherwise
+// the container port mappings
+func (a *marathonApp) portDescriptors() []PortMapping {
+	descriptors := []PortMapping{}
+
+	if len(a.PortDefinitions) > 0 {
+		for _, pd := range a.PortDefinitions {
+			descriptors = append(descriptors, PortMapping{Name: pd.Name, Protocol: normalizeProtocol(pd.Protocol)})
+		}
+		return descriptors
+	}
+
+	if a.Container == nil {
+		return descriptors
+	}
+
+	mappings := a.Container.PortMappings
+	if a.Container.Docker != nil && len(a.Container.Docker.PortMappings) > 0 {
+		mappings = a.Container.Docker.PortMappings
+	}
+
+	for _, pm := range mappings {
+		descriptors = append(descriptors, PortMapping{Name: pm.Name, Protocol: normalizeProtocol(pm.Protocol)})
+	}
+	return descriptors
+}
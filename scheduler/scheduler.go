@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"fmt"
 	"github.com/ContainX/beethoven/config"
 	"github.com/ContainX/beethoven/tracker"
 	"github.com/ContainX/depcon/pkg/logger"
@@ -19,10 +20,21 @@ var (
 func NewScheduler(cfg *config.Config, tracker *tracker.Tracker) Scheduler {
 
 	ss := &schedulerService{cfg: cfg, tracker: tracker}
+	return newBackend(cfg.SchedulerType, ss)
+}
 
-	switch cfg.SchedulerType {
+func newBackend(schedulerType config.SchedulerType, ss *schedulerService) Scheduler {
+	switch schedulerType {
 	case config.MarathonScheduler:
 		return createMarathonScheduler(ss)
+	case config.KubernetesScheduler:
+		return createKubernetesScheduler(ss)
+	case config.ConsulScheduler:
+		return createConsulScheduler(ss)
+	case config.FileScheduler:
+		return createFileScheduler(ss)
+	case config.CompositeScheduler:
+		return createCompositeScheduler(ss)
 	default:
 		return createSwarmScheduler(ss)
 	}
@@ -40,5 +52,9 @@ func (s *schedulerService) shouldTriggerReload(appId string, event interface{})
 		trigger = s.cfg.Filter().MatchString(appId)
 		log.Debugf("Matching appId: %s to filter: %s -> %v, Event: %s", appId, s.cfg.FilterRegExStr, trigger, event)
 	}
+	s.tracker.RecordSchedulerEvent(!trigger)
+	if trigger {
+		s.tracker.SetLastTrigger(fmt.Sprintf("%s: %v", appId, event))
+	}
 	return trigger
 }
@@ -16,6 +16,16 @@ import (
 const (
 	// SwarmWatchTime is the default interval when pulling for changes
 	SwarmWatchTimeSec = 10
+
+	// SwarmEventRetrySec is how long we poll before trying to re-establish the event stream
+	SwarmEventRetrySec = 60
+
+	// SwarmEventStableSec is how long the event stream must stay open, unless an event
+	// arrives first, before it is considered connected
+	SwarmEventStableSec = 5
+
+	// swarmStreamSource names the Docker event stream in the tracker
+	swarmStreamSource = "swarm"
 )
 
 type swarmService struct {
@@ -26,11 +36,13 @@ type swarmService struct {
 	shutdown      ShutdownChan
 	watchInterval time.Duration
 	nodes         *swarmNodes
+	lock          sync.Mutex
 }
 
 type Services []serviceData
 
 type serviceData struct {
+	ID              string
 	ServiceName     string
 	Name            string
 	Labels          map[string]string
@@ -38,6 +50,8 @@ type serviceData struct {
 	Health          string
 	Port            int
 	TargetPort      int
+	Ports           []PortMapping
+	Tasks           []taskData
 }
 
 type networkSettings struct {
@@ -71,7 +85,7 @@ func createSwarmScheduler(ss *schedulerService) Scheduler {
 		panic(err)
 	}
 	scheduler.client = client
-	scheduler.shutdown = make(ShutdownChan, 2)
+	scheduler.shutdown = make(ShutdownChan)
 	scheduler.nodes = &swarmNodes{
 		healthyNodes: []nodeData{},
 	}
@@ -100,51 +114,193 @@ func newDockerClient(cfg *config.SwarmConfig) (*docker.Client, error) {
 	return docker.NewClient(cfg.Endpoint)
 }
 
-// Watch for changes using polling and make callbacks to the specified
-// handler when apps have been added, removed or health changes.
-// Currently docker doesn't support Swarm events (https://github.com/moby/moby/issues/23827)
+// Watch for changes using the Docker events API and make callbacks to the specified
+// handler when services, nodes or service containers change.  If the event stream is
+// unavailable we fall back to polling until the stream can be re-established.
 func (s *swarmService) Watch(reload chan bool) {
 	log.Infof("Starting Swarm Watch...")
 	s.reload = reload
-	ticker := time.NewTicker(s.watchInterval)
 
-	go func(ticker *time.Ticker, s *swarmService) {
-		for {
-			select {
-			case <-ticker.C:
-				services, err := s.getServices()
-				s.updateNodeState()
-				if err != nil {
-					log.Errorf("Error fetching services from Swarm: %s", err.Error())
-				} else {
-					previous := s.services
-					s.services = services
+	go s.watchEvents()
+	s.triggerReload()
+}
 
-					// TODO: better comparison until #23827 is implemented
-					if topologyChanged(previous, services) {
-						s.reload <- true
-					}
-				}
-			case <-s.shutdown:
-				ticker.Stop()
+func (s *swarmService) Shutdown() {
+	close(s.shutdown)
+}
+
+// watchEvents listens to the Docker event stream, falling back to polling when the
+// stream can't be established or is closed before it was established
+func (s *swarmService) watchEvents() {
+	attempts := 0
+	connectedOnce := false
+	for {
+		listener := make(chan *docker.APIEvents, 10)
+		err := s.client.AddEventListener(listener)
+		if err == nil {
+			stopped, established := s.consumeEvents(listener, connectedOnce)
+			s.client.RemoveEventListener(listener)
+			if stopped {
+				s.tracker.SetEventStreamDisconnected(swarmStreamSource)
 				return
 			}
+			if established {
+				attempts = 0
+				connectedOnce = true
+				log.Warning("Docker event stream closed")
+				continue
+			}
+			// the client connects lazily so an unreachable daemon shows up as a
+			// listener which is closed shortly after being added
+			err = errors.New("event stream closed before it was established")
 		}
-	}(ticker, s)
-	s.reload <- true
+
+		attempts++
+		log.Warningf("Docker event stream unavailable, polling every %s: %s", s.watchInterval, err.Error())
+		s.tracker.SetEventStreamReconnecting(swarmStreamSource, attempts)
+		if !s.poll(SwarmEventRetrySec * time.Second) {
+			return
+		}
+	}
 }
 
-func (s *swarmService) Shutdown() {
-	s.shutdown <- true
+// consumeEvents handles events until the listener is closed or we are shutdown.  The
+// stream is established once an event arrives or it stays open for SwarmEventStableSec.
+// Returns whether we were shutdown and whether the stream was established
+func (s *swarmService) consumeEvents(listener chan *docker.APIEvents, connectedOnce bool) (stopped, established bool) {
+	// Docker does not emit task events, so replicas moving between nodes are only
+	// visible by polling.  This matters when routing to individual tasks
+	var poll <-chan time.Time
+	if s.taskEndpointsEnabled() {
+		ticker := time.NewTicker(s.watchInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	stable := time.NewTimer(SwarmEventStableSec * time.Second)
+	defer stable.Stop()
+
+	establish := func() {
+		if established {
+			return
+		}
+		established = true
+		s.tracker.SetEventStreamConnected(swarmStreamSource, s.cfg.Swarm.Endpoint)
+		// catch up on anything missed while we were not listening
+		s.refresh(connectedOnce)
+	}
+
+	for {
+		select {
+		case event, ok := <-listener:
+			if !ok {
+				return false, established
+			}
+			establish()
+			s.handleEvent(event)
+		case <-stable.C:
+			establish()
+		case <-poll:
+			s.refresh(false)
+		case <-s.shutdown:
+			return true, established
+		}
+	}
+}
+
+func (s *swarmService) handleEvent(event *docker.APIEvents) {
+	switch event.Type {
+	case "service":
+		// service updates (labels, ports, etc) always reload since topologyChanged
+		// only tracks a subset of the service definition
+		s.tracker.SetLastEvent(time.Now())
+		name := event.Actor.Attributes["name"]
+		if s.shouldTriggerReload(name, event.Action) {
+			s.refresh(true)
+		}
+	case "node":
+		s.tracker.SetLastEvent(time.Now())
+		s.updateNodeState()
+		if s.cfg.Swarm.RouteToNode {
+			s.triggerReload()
+		}
+	case "container":
+		// only care about containers which belong to a swarm service
+		name := event.Actor.Attributes["com.docker.swarm.service.name"]
+		if name == "" {
+			return
+		}
+		switch {
+		case event.Action == "start", event.Action == "die", strings.HasPrefix(event.Action, "health_status"):
+			s.tracker.SetLastEvent(time.Now())
+			if s.shouldTriggerReload(name, event.Action) {
+				s.refresh(false)
+			}
+		}
+	}
+}
+
+// poll for topology changes every watch interval for the specified duration.
+// Returns false if we were shutdown while polling
+func (s *swarmService) poll(duration time.Duration) bool {
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refresh(false)
+		case <-deadline:
+			return true
+		case <-s.shutdown:
+			return false
+		}
+	}
+}
+
+// refresh re-fetches services and node state and triggers a reload if forced or
+// the topology has changed
+func (s *swarmService) refresh(force bool) {
+	services, err := s.getServices()
+	s.updateNodeState()
+	if err != nil {
+		log.Errorf("Error fetching services from Swarm: %s", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	previous := s.services
+	s.services = services
+	s.lock.Unlock()
+
+	if force || topologyChanged(previous, services) {
+		s.triggerReload()
+	}
+}
+
+func (s *swarmService) triggerReload() {
+	select {
+	case s.reload <- true:
+	default:
+		log.Warning("Reload queue is full")
+	}
 }
 
 // Fetch all applications/services from the scheduler source
 func (s *swarmService) FetchApps() (map[string]*App, error) {
 	var err error
+	s.lock.Lock()
 	if s.services == nil || len(s.services) == 0 {
 		s.services, err = s.getServices()
 	}
-	converted := s.convertServiceToApp(s.services)
+	services := s.services
+	s.lock.Unlock()
+
+	if err == nil {
+		s.tracker.SetLastSync(time.Now())
+	}
+	converted := s.convertServiceToApp(services)
 	return converted, err
 }
 
@@ -198,10 +354,22 @@ func (s *swarmService) getServices() (Services, error) {
 		networkMap[network.ID] = &n
 	}
 
+	var tasks map[string][]taskData
+	if s.taskEndpointsEnabled() {
+		if tasks, err = s.getTasks(); err != nil {
+			log.Debugf("Failed to get tasks from swarm, error: %s", err)
+			return []serviceData{}, err
+		}
+	}
+
 	serviceDataList := Services{}
 
 	for _, service := range services {
 		sdata := parseService(service, networkMap)
+		if tasks != nil {
+			sdata.Tasks = tasks[service.ID]
+			sdata.Health = serviceHealth(sdata.Tasks)
+		}
 		serviceDataList = append(serviceDataList, sdata)
 	}
 
@@ -212,15 +380,26 @@ func (s *swarmService) getServices() (Services, error) {
 
 func parseService(service swarm.Service, networkMap map[string]*docker.Network) serviceData {
 	sdata := serviceData{
+		ID:              service.ID,
 		ServiceName:     service.Spec.Annotations.Name,
 		Name:            service.Spec.Annotations.Name,
 		Labels:          service.Spec.Annotations.Labels,
 		NetworkSettings: networkSettings{},
 	}
 
-	if service.Endpoint.Ports != nil && len(service.Endpoint.Ports) > 0 {
-		sdata.Port = int(service.Endpoint.Ports[0].PublishedPort)
-		sdata.TargetPort = int(service.Endpoint.Ports[0].TargetPort)
+	sdata.Ports = []PortMapping{}
+	for _, port := range service.Endpoint.Ports {
+		sdata.Ports = append(sdata.Ports, PortMapping{
+			Name:        port.Name,
+			Protocol:    normalizeProtocol(string(port.Protocol)),
+			Port:        int(port.TargetPort),
+			ServicePort: int(port.PublishedPort),
+		})
+	}
+
+	if len(sdata.Ports) > 0 {
+		sdata.Port = sdata.Ports[0].ServicePort
+		sdata.TargetPort = sdata.Ports[0].Port
 	}
 
 	if service.Spec.EndpointSpec != nil {
@@ -319,6 +498,26 @@ func (a serviceData) Equal(b serviceData) bool {
 	if a.Port != b.Port {
 		return false
 	}
+
+	if len(a.Ports) != len(b.Ports) {
+		return false
+	}
+
+	for i := range a.Ports {
+		if a.Ports[i] != b.Ports[i] {
+			return false
+		}
+	}
+
+	if len(a.Tasks) != len(b.Tasks) {
+		return false
+	}
+
+	for i := range a.Tasks {
+		if a.Tasks[i] != b.Tasks[i] {
+			return false
+		}
+	}
 	return true
 }
 
@@ -337,21 +536,31 @@ func (s Services) Swap(i, j int) {
 func (s *swarmService) convertServiceToApp(serviceData []serviceData) map[string]*App {
 	apps := make(map[string]*App)
 	for _, service := range serviceData {
-		address := s.getAddress(service)
-		if address == "" {
-			log.Errorf("Could not find network address for: %S, skipping in template", service.Name)
-			continue
-		}
+		var tasks []Task
+		if s.taskEndpointsEnabled() {
+			tasks = s.taskEndpoints(service)
+			if len(tasks) == 0 {
+				log.Debugf("No healthy tasks for: %s, skipping in template", service.Name)
+				continue
+			}
+		} else {
+			address := s.getAddress(service)
+			if address == "" {
+				log.Errorf("Could not find network address for: %s, skipping in template", service.Name)
+				continue
+			}
 
-		swarmTask := Task{}
-		swarmTask.Host = address
-		swarmTask.Ports = []int{service.TargetPort}
-		swarmTask.ServicePorts = []int{service.Port}
+			swarmTask := Task{}
+			swarmTask.Host = address
+			swarmTask.setPortMappings(service.Ports)
+			tasks = []Task{swarmTask}
+		}
 
 		app := App{}
 		app.AppId = service.ServiceName
+		app.Id = service.ID
 		app.Labels = service.Labels
-		app.Tasks = []Task{swarmTask}
+		app.Tasks = tasks
 		apps[service.ServiceName] = &app
 	}
 	return apps
@@ -0,0 +1,185 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	TaskHealthy   = "healthy"
+	TaskUnhealthy = "unhealthy"
+	TaskStarting  = "starting"
+
+	// labels Swarm sets on the containers of service tasks
+	swarmServiceIdLabel = "com.docker.swarm.service.id"
+	swarmTaskIdLabel    = "com.docker.swarm.task.id"
+)
+
+// taskData is a single running replica of a Swarm service
+type taskData struct {
+	ID      string
+	NodeID  string
+	Address string
+	Health  string
+}
+
+func (s *swarmService) taskEndpointsEnabled() bool {
+	return s.cfg.Swarm.TaskEndpoints && !s.cfg.Swarm.RouteToNode
+}
+
+// getTasks lists all running tasks grouped by service id, resolving each task's address
+// on the configured network and the health of its container
+func (s *swarmService) getTasks() (map[string][]taskData, error) {
+	tasks, err := s.client.ListTasks(docker.ListTasksOptions{
+		Filters: map[string][]string{"desired-state": {"running"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := s.containerHealth()
+
+	result := map[string][]taskData{}
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+
+		address := s.taskAddress(task)
+		if address == "" {
+			log.Debugf("Could not find network address for task: %s", task.ID)
+			continue
+		}
+
+		result[task.ServiceID] = append(result[task.ServiceID], taskData{
+			ID:      task.ID,
+			NodeID:  task.NodeID,
+			Address: address,
+			Health:  taskHealth(task, containers),
+		})
+	}
+
+	for id := range result {
+		sort.Sort(tasksByAddress(result[id]))
+	}
+	return result, nil
+}
+
+// taskAddress resolves the container IP of the task on the configured network,
+// falling back to the ingress network and then any attached network
+func (s *swarmService) taskAddress(task swarm.Task) string {
+	addresses := map[string]string{}
+	first := ""
+
+	for _, attachment := range task.NetworksAttachments {
+		if len(attachment.Addresses) == 0 {
+			continue
+		}
+		ip, _, err := net.ParseCIDR(attachment.Addresses[0])
+		if err != nil {
+			continue
+		}
+		addresses[attachment.Network.Spec.Annotations.Name] = ip.String()
+		if first == "" {
+			first = ip.String()
+		}
+	}
+
+	if address, ok := addresses[s.cfg.Swarm.Network]; ok {
+		return address
+	}
+	if address, ok := addresses["ingress"]; ok {
+		return address
+	}
+	return first
+}
+
+// containerHealth lists the service containers visible from this node in a single call
+// and returns the health of each keyed by task id
+func (s *swarmService) containerHealth() map[string]string {
+	health := map[string]string{}
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{
+		Filters: map[string][]string{"label": {swarmServiceIdLabel}},
+	})
+	if err != nil {
+		log.Warningf("Error listing service containers, health checks will be ignored: %s", err.Error())
+		return health
+	}
+
+	for _, c := range containers {
+		if id := c.Labels[swarmTaskIdLabel]; id != "" {
+			health[id] = containerStatusHealth(c.Status)
+		}
+	}
+	return health
+}
+
+// containerStatusHealth parses the health check state from a container status.
+// ex: Up 2 minutes (health: starting)
+func containerStatusHealth(status string) string {
+	switch {
+	case strings.Contains(status, "(health: starting)"):
+		return TaskStarting
+	case strings.Contains(status, "(unhealthy)"):
+		return TaskUnhealthy
+	}
+	return TaskHealthy
+}
+
+// taskHealth determines the health of a running task from its container health check.
+// Containers on other nodes aren't visible from here, those tasks are healthy since Swarm
+// only marks them running once started and replaces them when their check fails
+func taskHealth(task swarm.Task, containers map[string]string) string {
+	if health, ok := containers[task.ID]; ok {
+		return health
+	}
+	return TaskHealthy
+}
+
+// taskEndpoints returns a Task for each healthy replica of the service
+func (s *swarmService) taskEndpoints(service serviceData) []Task {
+	tasks := []Task{}
+	for _, td := range service.Tasks {
+		if td.Health != TaskHealthy {
+			continue
+		}
+
+		task := Task{}
+		task.Host = td.Address
+		task.setPortMappings(service.Ports)
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// serviceHealth summarizes task health for the service. ex: 2/3 healthy
+func serviceHealth(tasks []taskData) string {
+	healthy := 0
+	states := []string{}
+	for _, t := range tasks {
+		if t.Health == TaskHealthy {
+			healthy++
+		}
+		states = append(states, t.Health)
+	}
+	return fmt.Sprintf("%d/%d %s (%s)", healthy, len(tasks), TaskHealthy, strings.Join(states, ","))
+}
+
+type tasksByAddress []taskData
+
+func (t tasksByAddress) Len() int {
+	return len(t)
+}
+
+func (t tasksByAddress) Less(i, j int) bool {
+	return t[i].Address < t[j].Address
+}
+
+func (t tasksByAddress) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
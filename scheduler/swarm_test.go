@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/tracker"
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"testing"
+)
+
+func newTestSwarm(cfg *config.SwarmConfig) *swarmService {
+	c := &config.Config{Swarm: cfg}
+	return &swarmService{schedulerService: &schedulerService{cfg: c, tracker: tracker.New(c)}}
+}
+
+func TestSwarmFetchAppsRecordsSync(t *testing.T) {
+	s := newTestSwarm(&config.SwarmConfig{Network: "beethoven"})
+	s.services = Services{{
+		ID:          "abc",
+		ServiceName: "web",
+		Port:        80,
+		NetworkSettings: networkSettings{Networks: map[string]*networkData{
+			"beethoven": {Name: "beethoven", Address: "10.0.0.5"},
+		}},
+	}}
+
+	apps, err := s.FetchApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps["web"].Tasks[0].Host != "10.0.0.5" {
+		t.Errorf("Expected web on 10.0.0.5, got %+v", apps)
+	}
+	if s.tracker.GetStatus().LastUpdated.LastSync.IsZero() {
+		t.Errorf("Expected last sync to be recorded")
+	}
+	if reasons := s.tracker.Unready(0); len(reasons) != 0 {
+		t.Errorf("Expected ready after a Swarm sync, got %v", reasons)
+	}
+}
+
+func TestSwarmTaskHealth(t *testing.T) {
+	containers := map[string]string{}
+	for status, expected := range map[string]string{
+		"Up 2 minutes":                    TaskHealthy,
+		"Up 2 minutes (healthy)":          TaskHealthy,
+		"Up 5 seconds (health: starting)": TaskStarting,
+		"Up 3 minutes (unhealthy)":        TaskUnhealthy,
+	} {
+		containers[status] = containerStatusHealth(status)
+		if health := taskHealth(swarm.Task{ID: status}, containers); health != expected {
+			t.Errorf("Expected task with container %q to be %s, got %s", status, expected, health)
+		}
+	}
+
+	if health := taskHealth(swarm.Task{ID: "remote"}, containers); health != TaskHealthy {
+		t.Errorf("Expected running task on another node to be healthy, got %s", health)
+	}
+}
+
+func TestSwarmTaskAddress(t *testing.T) {
+	attachment := func(network, address string) swarm.NetworkAttachment {
+		a := swarm.NetworkAttachment{Addresses: []string{address}}
+		a.Network.Spec.Annotations.Name = network
+		return a
+	}
+	task := swarm.Task{NetworksAttachments: []swarm.NetworkAttachment{
+		attachment("other", "10.0.2.5/24"),
+		attachment("ingress", "10.255.0.5/16"),
+		attachment("beethoven", "10.0.1.5/24"),
+	}}
+
+	if address := newTestSwarm(&config.SwarmConfig{Network: "beethoven"}).taskAddress(task); address != "10.0.1.5" {
+		t.Errorf("Expected address on the configured network, got %s", address)
+	}
+	if address := newTestSwarm(&config.SwarmConfig{Network: "missing"}).taskAddress(task); address != "10.255.0.5" {
+		t.Errorf("Expected ingress address, got %s", address)
+	}
+
+	task.NetworksAttachments = task.NetworksAttachments[:1]
+	if address := newTestSwarm(&config.SwarmConfig{Network: "missing"}).taskAddress(task); address != "10.0.2.5" {
+		t.Errorf("Expected first attached address, got %s", address)
+	}
+}
+
+func TestSwarmTaskEndpoints(t *testing.T) {
+	s := newTestSwarm(&config.SwarmConfig{TaskEndpoints: true})
+	service := serviceData{
+		Ports: []PortMapping{{Port: 8080, ServicePort: 80}},
+		Tasks: []taskData{
+			{ID: "t1", Address: "10.0.1.5", Health: TaskHealthy},
+			{ID: "t2", Address: "10.0.1.6", Health: TaskStarting},
+			{ID: "t3", Address: "10.0.1.7", Health: TaskHealthy},
+		},
+	}
+
+	tasks := s.taskEndpoints(service)
+	if len(tasks) != 2 || tasks[0].Host != "10.0.1.5" || tasks[1].Host != "10.0.1.7" {
+		t.Fatalf("Expected a task per healthy replica, got %+v", tasks)
+	}
+	if tasks[0].Ports[0] != 8080 || tasks[0].ServicePorts[0] != 80 {
+		t.Errorf("Expected service ports on each task, got %+v", tasks[0])
+	}
+}
+
+func TestSwarmStreamClosedEarlyIsNotEstablished(t *testing.T) {
+	s := newTestSwarm(&config.SwarmConfig{Endpoint: "tcp://127.0.0.1:2375"})
+	s.shutdown = make(ShutdownChan)
+
+	listener := make(chan *docker.APIEvents)
+	close(listener)
+
+	stopped, established := s.consumeEvents(listener, false)
+	if stopped || established {
+		t.Errorf("Expected a listener closed right away to not be established, got stopped: %v, established: %v", stopped, established)
+	}
+	if sources := s.tracker.GetStatus().EventStream.Sources; len(sources) != 0 {
+		t.Errorf("Expected the stream to not be reported as connected, got %+v", sources)
+	}
+}
@@ -1,19 +1,77 @@
 package scheduler
 
 type App struct {
-	AppId  string
-	Tasks  []Task
-	Labels map[string]string
-	Env    map[string]string
+	// AppId is the template safe identifier of the app.  ex: products-web
+	AppId string
+	// Id is the identifier as known by the scheduler.  ex: /products/web
+	Id        string
+	Instances int
+	Tasks     []Task
+	Labels    map[string]string
+	Env       map[string]string
+
+	HealthChecks    []HealthCheck
+	PortDefinitions []PortDefinition
+
+	// IpPerTask is true when each task has its own IP address
+	IpPerTask bool
+
+	// IpTasks are IP-per-task tasks without host ports.  Their Host is the task IP
+	// address and Ports the container ports, which are only reachable on the container
+	// network.  Tasks only holds tasks reachable on the agent host
+	IpTasks []Task
+}
+
+type HealthCheck struct {
+	Protocol               string
+	Path                   string
+	PortIndex              int
+	Port                   int
+	GracePeriodSeconds     int
+	IntervalSeconds        int
+	TimeoutSeconds         int
+	MaxConsecutiveFailures int
+}
+
+type PortDefinition struct {
+	Port     int
+	Protocol string
+	Name     string
+	Labels   map[string]string
 }
 
 type Task struct {
+	Id           string
+	AppId        string
+	SlaveId      string
 	Host         string
 	Ports        []int
 	ServicePorts []int
 	StagedAt     string
 	StartedAt    string
 	Version      string
+
+	// IpAddresses assigned to the task when using IP-per-task networking
+	IpAddresses []IpAddress
+
+	// PortMappings are all ports of the task in declared order including the name
+	// and protocol when known.  Ports and ServicePorts are derived from these
+	PortMappings []PortMapping
+
+	// NamedPorts are the PortMappings which have a name, keyed by name
+	NamedPorts map[string]PortMapping
+}
+
+type PortMapping struct {
+	Name        string
+	Protocol    string
+	Port        int
+	ServicePort int
+}
+
+type IpAddress struct {
+	IpAddress string
+	Protocol  string
 }
 
 type BeethovenInstance struct {
@@ -1,6 +1,12 @@
 package scheduler
 
-import "os"
+import (
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 func tlsEnabled(tlsCert, tlsCaCert, tlsKey string) bool {
 	for _, v := range []string{tlsCert, tlsCaCert, tlsKey} {
@@ -22,3 +28,58 @@ func pathExists(path string) (bool, error) {
 	}
 	return false, err
 }
+
+// setPortMappings assigns the port mappings to the task along with the
+// derived Ports, ServicePorts and NamedPorts
+func (t *Task) setPortMappings(mappings []PortMapping) {
+	t.PortMappings = mappings
+	t.Ports = make([]int, len(mappings))
+	t.ServicePorts = make([]int, len(mappings))
+	t.NamedPorts = map[string]PortMapping{}
+
+	for i, pm := range mappings {
+		t.Ports[i] = pm.Port
+		t.ServicePorts[i] = pm.ServicePort
+		if pm.Name != "" {
+			t.NamedPorts[pm.Name] = pm
+		}
+	}
+}
+
+// portMappings creates unnamed mappings for ports and their matching service ports
+func portMappings(ports, servicePorts []int) []PortMapping {
+	mappings := make([]PortMapping, len(ports))
+	for i, port := range ports {
+		mappings[i] = PortMapping{Port: port}
+		if i < len(servicePorts) {
+			mappings[i].ServicePort = servicePorts[i]
+		}
+	}
+	return mappings
+}
+
+func normalizeProtocol(protocol string) string {
+	return strings.ToLower(protocol)
+}
+
+// AllTasks returns the Tasks followed by the IpTasks of the app
+func (a *App) AllTasks() []Task {
+	tasks := make([]Task, 0, len(a.Tasks)+len(a.IpTasks))
+	return append(append(tasks, a.Tasks...), a.IpTasks...)
+}
+
+// TaskAddresses returns the host:port of every task, including IpTasks, using the
+// port selected by the app
+func (a *App) TaskAddresses() []string {
+	index := a.PortIndex()
+	addresses := []string{}
+
+	for _, task := range a.AllTasks() {
+		if index >= len(task.Ports) {
+			continue
+		}
+		addresses = append(addresses, net.JoinHostPort(task.Host, strconv.Itoa(task.Ports[index])))
+	}
+	sort.Strings(addresses)
+	return addresses
+}
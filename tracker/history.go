@@ -0,0 +1,98 @@
+package tracker
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of events kept in the history
+const (
+	EventSync           = "sync"
+	EventRender         = "render"
+	EventValidation     = "validation"
+	EventReload         = "reload"
+	EventUpstreamUpdate = "upstream_update"
+	EventRollback       = "rollback"
+	EventError          = "error"
+)
+
+// Event is an entry in the history of what Beethoven has done
+type Event struct {
+	Id         uint64    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Type       string    `json:"type"`
+	Message    string    `json:"message,omitempty"`
+	DurationMs float64   `json:"duration_ms,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// HistoryPage is a page of events, newest first
+type HistoryPage struct {
+	Total  int      `json:"total"`
+	Offset int      `json:"offset"`
+	Limit  int      `json:"limit"`
+	Events []*Event `json:"events"`
+}
+
+// history is a ring buffer keeping the most recent events
+type history struct {
+	lock   sync.RWMutex
+	events []*Event
+	next   int
+	count  int
+	lastId uint64
+}
+
+func newHistory(size int) *history {
+	return &history{events: make([]*Event, size)}
+}
+
+func (h *history) add(eventType string, d time.Duration, message string, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.lastId++
+	event := &Event{
+		Id:         h.lastId,
+		Timestamp:  time.Now(),
+		Type:       eventType,
+		Message:    message,
+		DurationMs: float64(d) / float64(time.Millisecond),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	h.events[h.next] = event
+	h.next = (h.next + 1) % len(h.events)
+	if h.count < len(h.events) {
+		h.count++
+	}
+}
+
+// page returns up to limit events, newest first, skipping the newest offset events.
+// An empty eventType matches all events
+func (h *history) page(offset, limit int, eventType string) HistoryPage {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	result := HistoryPage{Offset: offset, Limit: limit, Events: []*Event{}}
+	for i := 0; i < h.count; i++ {
+		event := h.events[(h.next-1-i+len(h.events))%len(h.events)]
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+
+		if result.Total >= offset && len(result.Events) < limit {
+			result.Events = append(result.Events, event)
+		}
+		result.Total++
+	}
+	return result
+}
+
+// History returns a page of the most recent events, newest first.  An empty
+// eventType returns events of all types
+func (tr *Tracker) History(offset, limit int, eventType string) HistoryPage {
+	return tr.history.page(offset, limit, eventType)
+}
@@ -0,0 +1,60 @@
+package tracker
+
+import (
+	"errors"
+	"github.com/ContainX/beethoven/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryPaging(t *testing.T) {
+	tr := New(&config.Config{HistorySize: 5})
+	for i := 0; i < 4; i++ {
+		tr.ObserveRender(time.Millisecond)
+		tr.ObserveReload(time.Millisecond, nil)
+	}
+	tr.SetError(ErrorKindFetch, errors.New("boom"))
+
+	page := tr.History(0, 2, "")
+	if page.Total != 5 || len(page.Events) != 2 {
+		t.Fatalf("Expected 2 of 5 events, got %d of %d", len(page.Events), page.Total)
+	}
+	if page.Events[0].Type != EventError || page.Events[0].Error != "boom" || page.Events[0].Id != 9 {
+		t.Errorf("Expected newest event first, got %+v", page.Events[0])
+	}
+
+	page = tr.History(4, 10, "")
+	if len(page.Events) != 1 || page.Events[0].Id != 5 {
+		t.Errorf("Expected oldest retained event, got %+v", page.Events)
+	}
+
+	page = tr.History(0, 10, EventReload)
+	if page.Total != 2 || page.Events[0].Type != EventReload {
+		t.Errorf("Expected reload events only, got %+v", page)
+	}
+}
+
+func TestTrackerConcurrentAccess(t *testing.T) {
+	tr := New(&config.Config{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tr.SetLastEvent(time.Now())
+				tr.RecordReloadEvent(j%2 == 0)
+				tr.ObserveFetchApps(time.Millisecond, nil)
+				tr.GetStatus()
+				tr.History(0, 10, "")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if events := tr.GetStatus().Reloads.Events; events != 1000 {
+		t.Errorf("Expected 1000 events, got %d", events)
+	}
+}
@@ -0,0 +1,187 @@
+package tracker
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the Prometheus text exposition format served by WriteMetrics
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// durationBuckets are the upper bounds in seconds of the duration histograms
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metrics are the counters and histograms exposed to Prometheus.  They are updated
+// from the scheduler watchers and the generator so are guarded by their own lock
+type metrics struct {
+	lock sync.Mutex
+
+	schedulerEvents    uint64
+	filteredEvents     uint64
+	fetchErrors        uint64
+	validationFailures uint64
+	reloads            uint64
+	reloadFailures     uint64
+	apps               int
+	tasks              int
+
+	fetchDuration  *histogram
+	renderDuration *histogram
+	reloadDuration *histogram
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		fetchDuration:  newHistogram(durationBuckets),
+		renderDuration: newHistogram(durationBuckets),
+		reloadDuration: newHistogram(durationBuckets),
+	}
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// RecordSchedulerEvent counts an event received from the scheduler and whether the
+// filter dropped it
+func (tr *Tracker) RecordSchedulerEvent(filtered bool) {
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+
+	tr.metrics.schedulerEvents++
+	if filtered {
+		tr.metrics.filteredEvents++
+	}
+}
+
+// ObserveFetchApps records the latency and outcome of fetching apps from the scheduler
+func (tr *Tracker) ObserveFetchApps(d time.Duration, err error) {
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+
+	tr.metrics.fetchDuration.observe(d)
+	if err != nil {
+		tr.metrics.fetchErrors++
+	}
+	tr.history.add(EventSync, d, "fetched apps from the scheduler", err)
+}
+
+// ObserveRender records the time taken to render the templates
+func (tr *Tracker) ObserveRender(d time.Duration) {
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+
+	tr.metrics.renderDuration.observe(d)
+	tr.history.add(EventRender, d, "rendered templates", nil)
+}
+
+// ObserveValidation records the time taken by the proxy to validate a config and
+// whether it was rejected
+func (tr *Tracker) ObserveValidation(d time.Duration, err error) {
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+
+	if err != nil {
+		tr.metrics.validationFailures++
+	}
+	tr.history.add(EventValidation, d, "validated config", err)
+}
+
+// ObserveReload records the duration and outcome of a proxy reload
+func (tr *Tracker) ObserveReload(d time.Duration, err error) {
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+
+	tr.metrics.reloadDuration.observe(d)
+	tr.metrics.reloads++
+	if err != nil {
+		tr.metrics.reloadFailures++
+	}
+	tr.history.add(EventReload, d, "reloaded proxy", err)
+}
+
+// SetAppCounts records the number of apps and tasks in the current context
+func (tr *Tracker) SetAppCounts(apps, tasks int) {
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+
+	tr.metrics.apps = apps
+	tr.metrics.tasks = tasks
+}
+
+// WriteMetrics writes all metrics in the Prometheus text exposition format
+func (tr *Tracker) WriteMetrics(w io.Writer) {
+	status := tr.GetStatus()
+
+	tr.metrics.lock.Lock()
+	defer tr.metrics.lock.Unlock()
+	m := tr.metrics
+
+	writeMetric(w, "beethoven_scheduler_events_total", "counter", "Events received from the scheduler.", float64(m.schedulerEvents))
+	writeMetric(w, "beethoven_scheduler_events_filtered_total", "counter", "Scheduler events dropped by the filter.", float64(m.filteredEvents))
+	writeHistogram(w, "beethoven_fetch_apps_duration_seconds", "Latency of fetching apps from the scheduler.", m.fetchDuration)
+	writeMetric(w, "beethoven_fetch_apps_errors_total", "counter", "Errors fetching apps from the scheduler.", float64(m.fetchErrors))
+	writeHistogram(w, "beethoven_render_duration_seconds", "Time taken to render the templates.", m.renderDuration)
+	writeMetric(w, "beethoven_validation_failures_total", "counter", "Rendered configs rejected by the proxy.", float64(m.validationFailures))
+	writeMetric(w, "beethoven_proxy_reloads_total", "counter", "Proxy reloads.", float64(m.reloads))
+	writeMetric(w, "beethoven_proxy_reload_failures_total", "counter", "Proxy reloads which failed.", float64(m.reloadFailures))
+	writeHistogram(w, "beethoven_proxy_reload_duration_seconds", "Time taken to reload the proxy.", m.reloadDuration)
+	writeMetric(w, "beethoven_apps", "gauge", "Apps in the current context.", float64(m.apps))
+	writeMetric(w, "beethoven_tasks", "gauge", "Tasks in the current context.", float64(m.tasks))
+
+	writeMetric(w, "beethoven_reload_events_total", "counter", "Reload events received by the generator.", float64(status.Reloads.Events))
+	writeMetric(w, "beethoven_reload_events_coalesced_total", "counter", "Reload events folded into a pending render.", float64(status.Reloads.Coalesced))
+
+	connected := 0.0
+	if status.EventStream.Connected {
+		connected = 1
+	}
+	writeMetric(w, "beethoven_event_stream_connected", "gauge", "Whether the scheduler event stream is connected.", connected)
+
+	sinceSync := math.NaN()
+	if !status.LastUpdated.LastSync.IsZero() {
+		sinceSync = time.Since(status.LastUpdated.LastSync).Seconds()
+	}
+	writeMetric(w, "beethoven_seconds_since_last_sync", "gauge", "Seconds since apps were last fetched from the scheduler.", sinceSync)
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatFloat(value))
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(upper), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, formatFloat(h.sum), name, h.count)
+}
+
+func formatFloat(v float64) string {
+	if math.IsNaN(v) {
+		return "NaN"
+	}
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,46 @@
+package tracker
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ContainX/beethoven/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	tr := New(&config.Config{})
+	tr.RecordSchedulerEvent(false)
+	tr.RecordSchedulerEvent(true)
+	tr.ObserveFetchApps(20*time.Millisecond, nil)
+	tr.ObserveFetchApps(3*time.Second, errors.New("timeout"))
+	tr.ObserveReload(200*time.Millisecond, nil)
+	tr.ObserveValidation(10*time.Millisecond, errors.New("invalid"))
+	tr.SetAppCounts(2, 5)
+	tr.SetEventStreamConnected("marathon", "http://marathon:8080")
+
+	buf := &bytes.Buffer{}
+	tr.WriteMetrics(buf)
+	out := buf.String()
+
+	for _, expected := range []string{
+		"beethoven_scheduler_events_total 2\n",
+		"beethoven_scheduler_events_filtered_total 1\n",
+		"beethoven_fetch_apps_errors_total 1\n",
+		"beethoven_fetch_apps_duration_seconds_bucket{le=\"0.025\"} 1\n",
+		"beethoven_fetch_apps_duration_seconds_bucket{le=\"5\"} 2\n",
+		"beethoven_fetch_apps_duration_seconds_count 2\n",
+		"beethoven_proxy_reloads_total 1\n",
+		"beethoven_validation_failures_total 1\n",
+		"beethoven_apps 2\n",
+		"beethoven_tasks 5\n",
+		"beethoven_event_stream_connected 1\n",
+		"beethoven_seconds_since_last_sync NaN\n",
+		"# TYPE beethoven_render_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, out)
+		}
+	}
+}
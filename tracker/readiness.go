@@ -0,0 +1,33 @@
+package tracker
+
+import (
+	"fmt"
+	"time"
+)
+
+// Unready returns the reasons config generation is degraded, empty when ready.  A sync
+// older than maxSyncAge is stale, a maxSyncAge of 0 only requires a sync to have happened
+func (tr *Tracker) Unready(maxSyncAge time.Duration) []string {
+	status := tr.GetStatus()
+	reasons := []string{}
+
+	for _, stream := range status.EventStream.Sources {
+		if !stream.Connected {
+			reasons = append(reasons, fmt.Sprintf("scheduler event stream %s disconnected, %d reconnect attempts", stream.Source, stream.Attempts))
+		}
+	}
+
+	lastSync := status.LastUpdated.LastSync
+	if lastSync.IsZero() {
+		reasons = append(reasons, "apps have not been fetched from the scheduler")
+	} else if age := time.Since(lastSync); maxSyncAge > 0 && age > maxSyncAge {
+		reasons = append(reasons, fmt.Sprintf("last sync was %s ago, more than %s", age.Truncate(time.Second), maxSyncAge))
+	}
+
+	if e := status.LastError; e != nil {
+		reasons = append(reasons, fmt.Sprintf("last %s failed: %s", e.Kind, e.Message))
+	} else if status.ValidationError != nil {
+		reasons = append(reasons, "last rendered config is invalid: "+status.ValidationError.Error)
+	}
+	return reasons
+}
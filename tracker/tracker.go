@@ -2,59 +2,272 @@ package tracker
 
 import (
 	"github.com/ContainX/beethoven/config"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Tracker is responsible for keeping track of state and updates
 // throughout Beethoven.  It serves as a common information hub to
-// the API
+// the API.  It is updated from the scheduler watchers, the generator
+// and the API so all access is guarded by a lock
 type Tracker struct {
-	cfg    *config.Config
-	status Status
+	cfg     *config.Config
+	lock    sync.RWMutex
+	status  Status
+	streams map[string]*StreamSource
+	metrics *metrics
+	history *history
 }
 
 func New(cfg *config.Config) *Tracker {
+	size := cfg.HistorySize
+	if size <= 0 {
+		size = config.DefaultHistorySize
+	}
+
 	return &Tracker{
 		cfg: cfg,
 		status: Status{
 			LastUpdated: Updates{},
 		},
+		streams: map[string]*StreamSource{},
+		metrics: newMetrics(),
+		history: newHistory(size),
 	}
 }
 
+// GetStatus returns a copy of the current status
 func (tr *Tracker) GetStatus() Status {
+	tr.lock.RLock()
+	defer tr.lock.RUnlock()
 	return tr.status
 }
 
-func (tr *Tracker) SetError(err error) {
-	tr.status.LastError = err
+// update applies fn to the status while holding the lock
+func (tr *Tracker) update(fn func(status *Status)) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	fn(&tr.status)
+}
+
+// SetError records a failure of the kind of stage of config generation.  Failures are
+// counted until ClearError is called after a successful generation
+func (tr *Tracker) SetError(kind string, err error) {
+	tr.update(func(s *Status) {
+		consecutive := 1
+		if s.LastError != nil {
+			consecutive = s.LastError.ConsecutiveFailures + 1
+		}
+
+		s.LastError = &StatusError{
+			Message:             err.Error(),
+			Kind:                kind,
+			Timestamp:           time.Now(),
+			ConsecutiveFailures: consecutive,
+			Source:              s.EventStream.LastTrigger,
+		}
+	})
+	tr.history.add(EventError, 0, kind, err)
+}
+
+// ClearError marks config generation as successful
+func (tr *Tracker) ClearError() {
+	tr.update(func(s *Status) { s.LastError = nil })
 }
 
-func (tr *Tracker) SetValidationError(verr *ValidationError) {
-	tr.status.ValidationError = verr
+// SetValidationError records the config the proxy rejected
+func (tr *Tracker) SetValidationError(err error, failedConfig string) {
+	tr.update(func(s *Status) {
+		s.ValidationError = &ValidationError{Error: err.Error(), Timestamp: time.Now(), FailedConfig: failedConfig}
+	})
 }
 
 func (tr *Tracker) ClearValidationError() {
-	tr.status.ValidationError = nil
+	tr.update(func(s *Status) {
+		s.ValidationError = nil
+	})
+}
+
+// SetRollback records the last time an installed config was rolled back
+func (tr *Tracker) SetRollback(rollback *Rollback) {
+	tr.update(func(s *Status) {
+		s.LastRollback = rollback
+	})
+
+	message := "restored previous config"
+	if !rollback.Restored {
+		message = "unable to restore previous config: " + rollback.Error
+	}
+	tr.history.add(EventRollback, 0, message+" after: "+rollback.Reason, nil)
+}
+
+// RecordReloadEvent counts an event from the scheduler and whether it was coalesced
+// into a pending render
+func (tr *Tracker) RecordReloadEvent(coalesced bool) {
+	tr.update(func(s *Status) {
+		s.Reloads.Events++
+		if coalesced {
+			s.Reloads.Coalesced++
+		}
+	})
+}
+
+// RecordRender counts a render triggered by events and whether the maximum delay forced it
+func (tr *Tracker) RecordRender(forced bool) {
+	tr.update(func(s *Status) {
+		s.Reloads.Renders++
+		if forced {
+			s.Reloads.Forced++
+		}
+	})
+}
+
+// RecordThrottled counts a render held back by the minimum reload interval
+func (tr *Tracker) RecordThrottled() {
+	tr.update(func(s *Status) {
+		s.Reloads.Throttled++
+	})
+}
+
+// SetConfigDiff records the changes of each config file that was just installed
+func (tr *Tracker) SetConfigDiff(diffs []*ConfigDiff) {
+	tr.update(func(s *Status) {
+		s.LastConfigDiff = diffs
+	})
 }
 
 // SetLastSync will set the time we fetched a snapshot from Marathon
 func (tr *Tracker) SetLastSync(t time.Time) {
-	tr.status.LastUpdated.LastSync = t
+	tr.update(func(s *Status) {
+		s.LastUpdated.LastSync = t
+	})
 }
 
 // SetLastConfigRendered will set the time we rendered a temporary config
 func (tr *Tracker) SetLastConfigRendered(t time.Time) {
-	tr.status.LastUpdated.LastConfigRendered = t
+	tr.update(func(s *Status) {
+		s.LastUpdated.LastConfigRendered = t
+	})
 }
 
 // SetLastConfigValid captures the last time we had a successful rendered config validate
 // via the proxy
 func (tr *Tracker) SetLastConfigValid(t time.Time) {
-	tr.status.LastUpdated.LastConfigValid = t
+	tr.update(func(s *Status) {
+		s.LastUpdated.LastConfigValid = t
+	})
 }
 
 // SetLastProxyReload the last time we executed a reload on the proxy
 func (tr *Tracker) SetLastProxyReload(t time.Time) {
-	tr.status.LastUpdated.LastProxyReload = t
+	tr.update(func(s *Status) {
+		s.LastUpdated.LastProxyReload = t
+	})
+}
+
+// SetLastUpstreamUpdate the last time upstream servers were updated through the proxy API
+// instead of a reload
+func (tr *Tracker) SetLastUpstreamUpdate(t time.Time) {
+	tr.update(func(s *Status) {
+		s.LastUpdated.LastUpstreamUpdate = t
+	})
+	tr.history.add(EventUpstreamUpdate, 0, "updated upstreams without a reload", nil)
+}
+
+// SetEventStreamConnected marks the event stream of source as attached to endpoint
+func (tr *Tracker) SetEventStreamConnected(source, endpoint string) {
+	tr.updateStream(source, func(stream *StreamSource) {
+		stream.Connected = true
+		stream.Reconnecting = false
+		stream.Attempts = 0
+		stream.Endpoint = endpoint
+		stream.LastConnected = time.Now()
+	})
+}
+
+// SetEventStreamReconnecting marks the event stream of source as dropped along with the
+// number of failed reconnect attempts so far
+func (tr *Tracker) SetEventStreamReconnecting(source string, attempts int) {
+	tr.updateStream(source, func(stream *StreamSource) {
+		stream.Connected = false
+		stream.Reconnecting = true
+		stream.Attempts = attempts
+	})
+}
+
+// SetEventStreamDisconnected marks the event stream of source as intentionally closed
+func (tr *Tracker) SetEventStreamDisconnected(source string) {
+	tr.updateStream(source, nil)
+}
+
+// updateStream applies fn to the state of the source, or removes the source if fn is
+// nil, and aggregates the state of all sources into the EventStream
+func (tr *Tracker) updateStream(source string, fn func(stream *StreamSource)) {
+	tr.update(func(s *Status) {
+		if fn == nil {
+			delete(tr.streams, source)
+		} else {
+			stream, ok := tr.streams[source]
+			if !ok {
+				stream = &StreamSource{Source: source}
+				tr.streams[source] = stream
+			}
+			fn(stream)
+		}
+
+		names := make([]string, 0, len(tr.streams))
+		for name := range tr.streams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		es := &s.EventStream
+		es.Connected = len(names) > 0
+		es.Reconnecting = false
+		es.Attempts = 0
+		es.Sources = make([]StreamSource, 0, len(names))
+		endpoints := []string{}
+
+		for _, name := range names {
+			stream := tr.streams[name]
+			es.Sources = append(es.Sources, *stream)
+			es.Connected = es.Connected && stream.Connected
+			es.Reconnecting = es.Reconnecting || stream.Reconnecting
+			if stream.Attempts > es.Attempts {
+				es.Attempts = stream.Attempts
+			}
+			if stream.LastConnected.After(es.LastConnected) {
+				es.LastConnected = stream.LastConnected
+			}
+			if stream.Endpoint != "" && !containsString(endpoints, stream.Endpoint) {
+				endpoints = append(endpoints, stream.Endpoint)
+			}
+		}
+		es.Endpoint = strings.Join(endpoints, ", ")
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLastTrigger records the scheduler event which last triggered a reload
+func (tr *Tracker) SetLastTrigger(source string) {
+	tr.update(func(s *Status) {
+		s.EventStream.LastTrigger = source
+	})
+}
+
+// SetLastEvent will set the time we received an event from the scheduler
+func (tr *Tracker) SetLastEvent(t time.Time) {
+	tr.update(func(s *Status) {
+		s.EventStream.LastEvent = t
+	})
 }
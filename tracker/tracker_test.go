@@ -0,0 +1,98 @@
+package tracker
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ContainX/beethoven/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusErrorSerialization(t *testing.T) {
+	tr := New(&config.Config{})
+	tr.SetLastTrigger("/products: deployment_success")
+	tr.SetError(ErrorKindFetch, errors.New("connection refused"))
+	tr.SetError(ErrorKindRender, errors.New("bad template"))
+
+	lastError := tr.GetStatus().LastError
+	if lastError.ConsecutiveFailures != 2 || lastError.Kind != ErrorKindRender {
+		t.Errorf("Expected second consecutive render failure, got %+v", lastError)
+	}
+
+	b, err := json.Marshal(tr.GetStatus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"message":"bad template"`, `"kind":"render"`, `"source":"/products: deployment_success"`} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("Expected %s in %s", expected, b)
+		}
+	}
+
+	tr.ClearError()
+	tr.SetError(ErrorKindReload, errors.New("nginx failed"))
+	if tr.GetStatus().LastError.ConsecutiveFailures != 1 {
+		t.Errorf("Expected failures to reset after success")
+	}
+}
+
+func TestUnready(t *testing.T) {
+	tr := New(&config.Config{})
+	if reasons := tr.Unready(0); len(reasons) != 1 {
+		t.Errorf("Expected unready before the first sync, got %v", reasons)
+	}
+
+	tr.SetLastSync(time.Now().Add(-time.Minute))
+	tr.SetEventStreamConnected("marathon", "http://marathon:8080")
+	if reasons := tr.Unready(0); len(reasons) != 0 {
+		t.Errorf("Expected ready, got %v", reasons)
+	}
+
+	tr.SetEventStreamReconnecting("marathon", 3)
+	tr.SetError(ErrorKindValidate, errors.New("nginx: [emerg] unexpected \"}\""))
+	if reasons := tr.Unready(30 * time.Second); len(reasons) != 3 {
+		t.Errorf("Expected disconnected, stale and invalid config, got %v", reasons)
+	}
+}
+
+func TestUnreadyAfterFetchFailure(t *testing.T) {
+	tr := New(&config.Config{})
+	tr.SetLastSync(time.Now())
+	tr.SetError(ErrorKindFetch, errors.New("connection refused"))
+	if reasons := tr.Unready(0); len(reasons) != 1 {
+		t.Errorf("Expected unready after a failed fetch, got %v", reasons)
+	}
+
+	tr.ClearError()
+	if reasons := tr.Unready(0); len(reasons) != 0 {
+		t.Errorf("Expected ready after a successful generation, got %v", reasons)
+	}
+}
+
+func TestEventStreamSources(t *testing.T) {
+	tr := New(&config.Config{})
+	tr.SetEventStreamReconnecting("kubernetes:/api/v1/services", 2)
+	tr.SetEventStreamConnected("kubernetes:/api/v1/endpoints", "https://kubernetes")
+
+	es := tr.GetStatus().EventStream
+	if es.Connected || !es.Reconnecting || es.Attempts != 2 || len(es.Sources) != 2 {
+		t.Errorf("Expected a reconnecting source to keep the stream degraded, got %+v", es)
+	}
+
+	tr.SetLastSync(time.Now())
+	if reasons := tr.Unready(0); len(reasons) != 1 || !strings.Contains(reasons[0], "kubernetes:/api/v1/services") {
+		t.Errorf("Expected the reconnecting source to be reported, got %v", reasons)
+	}
+
+	tr.SetEventStreamConnected("kubernetes:/api/v1/services", "https://kubernetes")
+	if es := tr.GetStatus().EventStream; !es.Connected || es.Reconnecting || es.Endpoint != "https://kubernetes" {
+		t.Errorf("Expected all sources connected, got %+v", es)
+	}
+
+	tr.SetEventStreamDisconnected("kubernetes:/api/v1/services")
+	tr.SetEventStreamDisconnected("kubernetes:/api/v1/endpoints")
+	if es := tr.GetStatus().EventStream; es.Connected || len(es.Sources) != 0 {
+		t.Errorf("Expected no sources after disconnecting, got %+v", es)
+	}
+}
@@ -9,15 +9,114 @@ type Updates struct {
 	LastConfigRendered time.Time `json:"last_config_rendered"`
 	LastConfigValid    time.Time `json:"last_config_valid"`
 	LastProxyReload    time.Time `json:"last_proxy_reload"`
+	LastUpstreamUpdate time.Time `json:"last_upstream_update"`
 }
 
 type Status struct {
 	LastUpdated     Updates          `json:"last_updated"`
-	LastError       error            `json:"last_error"`
+	LastError       *StatusError     `json:"last_error"`
 	ValidationError *ValidationError `json:"validation_error"`
+	LastConfigDiff  []*ConfigDiff    `json:"last_config_diff"`
+	LastRollback    *Rollback        `json:"last_rollback"`
+	EventStream     EventStream      `json:"event_stream"`
+	Reloads         ReloadCounters   `json:"reloads"`
+}
+
+// ReloadCounters count scheduler events and how they were coalesced into renders
+type ReloadCounters struct {
+	// Events received from the scheduler
+	Events int64 `json:"events"`
+	// Events folded into a render which was already pending
+	Coalesced int64 `json:"coalesced"`
+	// Renders triggered by events
+	Renders int64 `json:"renders"`
+	// Renders forced by the maximum delay while events kept arriving
+	Forced int64 `json:"forced"`
+	// Renders held back by the minimum interval between proxy reloads
+	Throttled int64 `json:"throttled"`
+}
+
+// EventStream is the state of the connections to the scheduler event streams.  The
+// connection fields aggregate Sources: connected only if every source is connected and
+// reconnecting if any source is
+type EventStream struct {
+	Connected     bool      `json:"connected"`
+	Reconnecting  bool      `json:"reconnecting"`
+	Attempts      int       `json:"attempts"`
+	Endpoint      string    `json:"endpoint"`
+	LastConnected time.Time `json:"last_connected"`
+	LastEvent     time.Time `json:"last_event"`
+
+	// Sources are the individual streams and watches, ex. each watch of the Kubernetes
+	// scheduler or each scheduler of the composite scheduler
+	Sources []StreamSource `json:"sources"`
+
+	// LastTrigger describes the last event which triggered a reload
+	LastTrigger string `json:"last_trigger,omitempty"`
+}
+
+// StreamSource is the state of a single scheduler event stream or watch
+type StreamSource struct {
+	Source        string    `json:"source"`
+	Connected     bool      `json:"connected"`
+	Reconnecting  bool      `json:"reconnecting"`
+	Attempts      int       `json:"attempts"`
+	Endpoint      string    `json:"endpoint"`
+	LastConnected time.Time `json:"last_connected"`
+}
+
+// Kinds of StatusError, the stage of config generation which failed
+const (
+	ErrorKindFetch    = "fetch"
+	ErrorKindRender   = "render"
+	ErrorKindValidate = "validate"
+	ErrorKindReload   = "reload"
+)
+
+// StatusError describes the last failure of config generation
+type StatusError struct {
+	Message   string    `json:"message"`
+	Kind      string    `json:"kind"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// ConsecutiveFailures is the number of generations which have failed in a row
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// Source is the scheduler event which triggered the failed generation, if any
+	Source string `json:"source,omitempty"`
 }
 
 type ValidationError struct {
-	Error        error  `json:"error"`
-	FailedConfig string `json:"failed_config"`
+	Error        string    `json:"error"`
+	Timestamp    time.Time `json:"timestamp"`
+	FailedConfig string    `json:"failed_config"`
+}
+
+// ConfigDiff describes what changed in a config file the last time new config was
+// installed.  Line numbers of removed lines refer to the previous config, added lines
+// to the new one
+type ConfigDiff struct {
+	Path         string     `json:"path"`
+	Timestamp    time.Time  `json:"timestamp"`
+	PreviousHash string     `json:"previous_hash"`
+	CurrentHash  string     `json:"current_hash"`
+	AddedCount   int        `json:"added_count"`
+	RemovedCount int        `json:"removed_count"`
+	Added        []DiffLine `json:"added"`
+	Removed      []DiffLine `json:"removed"`
+	Truncated    bool       `json:"truncated"`
+}
+
+type DiffLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Rollback records a new config failing after install and the previous config
+// being restored
+type Rollback struct {
+	Timestamp time.Time `json:"timestamp"`
+	Reason    string    `json:"reason"`
+	Restored  bool      `json:"restored"`
+	Error     string    `json:"error,omitempty"`
 }
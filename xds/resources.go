@@ -0,0 +1,246 @@
+package xds
+
+import (
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	router "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	resource "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ListenerName is the name of the generated HTTP listener
+	ListenerName = "beethoven_http"
+
+	// RouteName is the name of the route configuration used by the HTTP listener
+	RouteName = "beethoven_routes"
+
+	// defaultDomain receives apps which declare a path without a virtual host
+	defaultDomain = "*"
+)
+
+// resources are the xDS resources generated from the scheduler apps
+type resources struct {
+	clusters  []types.Resource
+	endpoints []types.Resource
+	routes    []types.Resource
+	listeners []types.Resource
+}
+
+// lookupIP resolves task hosts which are not IP addresses.  EDS requires IP addresses
+var lookupIP = net.LookupIP
+
+// buildResources creates a cluster and load assignment for every app.  Apps with the
+// virtual host or path labels are also routed through the HTTP listener
+func buildResources(cfg *config.XdsConfig, apps map[string]*scheduler.App) (*resources, error) {
+	res := &resources{}
+
+	ids := make([]string, 0, len(apps))
+	for id := range apps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	domains := map[string][]*route.Route{}
+	timeout := time.Duration(cfg.ConnectTimeoutMs) * time.Millisecond
+
+	for _, id := range ids {
+		app := apps[id]
+		res.clusters = append(res.clusters, makeCluster(app.AppId, timeout))
+		res.endpoints = append(res.endpoints, makeLoadAssignment(app))
+
+		vhosts := app.VHosts()
+		path := app.Path()
+		if len(vhosts) == 0 && path == "" {
+			continue
+		}
+
+		if path == "" {
+			path = "/"
+		}
+		if len(vhosts) == 0 {
+			vhosts = []string{defaultDomain}
+		}
+
+		for _, vhost := range vhosts {
+			domains[vhost] = append(domains[vhost], makeRoute(app.AppId, path))
+		}
+	}
+
+	res.routes = []types.Resource{makeRouteConfiguration(domains)}
+
+	l, err := makeListener(cfg)
+	if err != nil {
+		return nil, err
+	}
+	res.listeners = []types.Resource{l}
+	return res, nil
+}
+
+func (r *resources) byType() map[resource.Type][]types.Resource {
+	return map[resource.Type][]types.Resource{
+		resource.ClusterType:  r.clusters,
+		resource.EndpointType: r.endpoints,
+		resource.RouteType:    r.routes,
+		resource.ListenerType: r.listeners,
+	}
+}
+
+func makeCluster(name string, timeout time.Duration) *cluster.Cluster {
+	return &cluster.Cluster{
+		Name:                 name,
+		ConnectTimeout:       durationpb.New(timeout),
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+		EdsClusterConfig:     &cluster.Cluster_EdsClusterConfig{EdsConfig: adsConfigSource()},
+		LbPolicy:             cluster.Cluster_ROUND_ROBIN,
+	}
+}
+
+// makeLoadAssignment creates an endpoint for every task, including IpTasks, using the
+// port selected by the app
+func makeLoadAssignment(app *scheduler.App) *endpoint.ClusterLoadAssignment {
+	index := app.PortIndex()
+	lbEndpoints := []*endpoint.LbEndpoint{}
+
+	for _, task := range app.AllTasks() {
+		if index >= len(task.Ports) {
+			log.Warningf("Task %s of %s has no port at index %d, skipping", task.Host, app.AppId, index)
+			continue
+		}
+
+		ip, err := resolve(task.Host)
+		if err != nil {
+			log.Warningf("Unable to resolve %s for %s, skipping: %s", task.Host, app.AppId, err.Error())
+			continue
+		}
+
+		lbEndpoints = append(lbEndpoints, &endpoint.LbEndpoint{
+			HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+				Endpoint: &endpoint.Endpoint{Address: socketAddress(ip, task.Ports[index])},
+			},
+		})
+	}
+
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: app.AppId,
+		Endpoints:   []*endpoint.LocalityLbEndpoints{{LbEndpoints: lbEndpoints}},
+	}
+}
+
+func makeRoute(cluster, path string) *route.Route {
+	return &route.Route{
+		Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: path}},
+		Action: &route.Route_Route{Route: &route.RouteAction{
+			ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster},
+		}},
+	}
+}
+
+// makeRouteConfiguration creates a virtual host per domain.  Routes are ordered by the
+// longest path prefix first since Envoy uses the first route that matches
+func makeRouteConfiguration(domains map[string][]*route.Route) *route.RouteConfiguration {
+	names := make([]string, 0, len(domains))
+	for domain := range domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+
+	vhosts := []*route.VirtualHost{}
+	for _, domain := range names {
+		routes := domains[domain]
+		sort.SliceStable(routes, func(i, j int) bool {
+			return len(routes[i].GetMatch().GetPrefix()) > len(routes[j].GetMatch().GetPrefix())
+		})
+
+		vhosts = append(vhosts, &route.VirtualHost{
+			Name:    strings.Replace(domain, "*", "default", -1),
+			Domains: []string{domain},
+			Routes:  routes,
+		})
+	}
+
+	return &route.RouteConfiguration{Name: RouteName, VirtualHosts: vhosts}
+}
+
+func makeListener(cfg *config.XdsConfig) (*listener.Listener, error) {
+	routerConfig, err := anypb.New(&router.Router{})
+	if err != nil {
+		return nil, err
+	}
+
+	manager, err := anypb.New(&hcm.HttpConnectionManager{
+		CodecType:  hcm.HttpConnectionManager_AUTO,
+		StatPrefix: "beethoven",
+		RouteSpecifier: &hcm.HttpConnectionManager_Rds{Rds: &hcm.Rds{
+			ConfigSource:    adsConfigSource(),
+			RouteConfigName: RouteName,
+		}},
+		HttpFilters: []*hcm.HttpFilter{{
+			Name:       wellknown.Router,
+			ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: routerConfig},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &listener.Listener{
+		Name:    ListenerName,
+		Address: socketAddress(cfg.ListenerAddress, cfg.ListenerPort),
+		FilterChains: []*listener.FilterChain{{
+			Filters: []*listener.Filter{{
+				Name:       wellknown.HTTPConnectionManager,
+				ConfigType: &listener.Filter_TypedConfig{TypedConfig: manager},
+			}},
+		}},
+	}, nil
+}
+
+func adsConfigSource() *core.ConfigSource {
+	return &core.ConfigSource{
+		ResourceApiVersion:    resource.DefaultAPIVersion,
+		ConfigSourceSpecifier: &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}},
+	}
+}
+
+func socketAddress(address string, port int) *core.Address {
+	return &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+		Protocol:      core.SocketAddress_TCP,
+		Address:       address,
+		PortSpecifier: &core.SocketAddress_PortValue{PortValue: uint32(port)},
+	}}}
+}
+
+func resolve(host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	ips, err := lookupIP(host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	if len(ips) > 0 {
+		return ips[0].String(), nil
+	}
+	return "", fmt.Errorf("No addresses found")
+}
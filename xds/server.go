@@ -0,0 +1,192 @@
+package xds
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	"github.com/ContainX/depcon/pkg/logger"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	clusterservice "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	listenerservice "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	routeservice "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	xdslog "github.com/envoyproxy/go-control-plane/pkg/log"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sync"
+)
+
+const (
+	// snapshotKey is the key every Envoy node is served from - all nodes receive the
+	// same configuration
+	snapshotKey = "beethoven"
+)
+
+var (
+	log = logger.GetLogger("beethoven.xds")
+)
+
+// Server is an Envoy control plane serving the scheduler apps over xDS.  Updates are
+// pushed to connected Envoys without any reload
+type Server struct {
+	cfg        *config.XdsConfig
+	cache      cachev3.SnapshotCache
+	grpcServer *grpc.Server
+	cancel     context.CancelFunc
+
+	lock      sync.RWMutex
+	version   string
+	resources *resources
+}
+
+// nodeHash maps every node to the same snapshot
+type nodeHash struct{}
+
+func (nodeHash) ID(node *core.Node) string {
+	return snapshotKey
+}
+
+func New(cfg *config.XdsConfig) *Server {
+	return &Server{
+		cfg: cfg,
+		cache: cachev3.NewSnapshotCache(true, nodeHash{}, xdslog.LoggerFuncs{
+			DebugFunc: log.Debugf,
+			InfoFunc:  log.Infof,
+			WarnFunc:  log.Warningf,
+			ErrorFunc: log.Errorf,
+		}),
+	}
+}
+
+// Serve the xDS gRPC API in the background
+func (s *Server) Serve() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Port))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	xds := serverv3.NewServer(ctx, s.cache, serverv3.CallbackFuncs{})
+
+	s.grpcServer = grpc.NewServer()
+	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(s.grpcServer, xds)
+	clusterservice.RegisterClusterDiscoveryServiceServer(s.grpcServer, xds)
+	endpointservice.RegisterEndpointDiscoveryServiceServer(s.grpcServer, xds)
+	listenerservice.RegisterListenerDiscoveryServiceServer(s.grpcServer, xds)
+	routeservice.RegisterRouteDiscoveryServiceServer(s.grpcServer, xds)
+
+	log.Infof("Serving xDS on port %d", s.cfg.Port)
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			log.Errorf("xDS server stopped: %s", err.Error())
+		}
+	}()
+	return nil
+}
+
+// Shutdown the gRPC server
+func (s *Server) Shutdown() {
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+		s.cancel()
+	}
+}
+
+// Update builds the resources for apps and pushes a new snapshot to all Envoys.  The
+// snapshot version is a hash of the resources so a snapshot is only pushed when the
+// resulting configuration has changed
+// return true if a new snapshot was pushed
+func (s *Server) Update(apps map[string]*scheduler.App) (bool, error) {
+	res, err := buildResources(s.cfg, apps)
+	if err != nil {
+		return false, err
+	}
+
+	version, err := hashResources(res)
+	if err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if version == s.version {
+		return false, nil
+	}
+
+	snapshot, err := cachev3.NewSnapshot(version, res.byType())
+	if err != nil {
+		return false, err
+	}
+
+	if err := snapshot.Consistent(); err != nil {
+		return false, fmt.Errorf("Inconsistent xDS snapshot: %s", err.Error())
+	}
+
+	if err := s.cache.SetSnapshot(context.Background(), snapshotKey, snapshot); err != nil {
+		return false, err
+	}
+
+	log.Infof("Pushed xDS snapshot version %s (%d clusters)", version, len(res.clusters))
+	s.version = version
+	s.resources = res
+	return true, nil
+}
+
+// Version of the current snapshot
+func (s *Server) Version() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.version
+}
+
+// Dump returns the resources of the current snapshot as JSON keyed by type
+func (s *Server) Dump() ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	dump := map[string]interface{}{"version": s.version}
+	if s.resources == nil {
+		return json.MarshalIndent(dump, "", "  ")
+	}
+
+	for typ, list := range s.resources.byType() {
+		items := []json.RawMessage{}
+		for _, r := range list {
+			b, err := protojson.Marshal(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, json.RawMessage(b))
+		}
+		dump[typ] = items
+	}
+	return json.MarshalIndent(dump, "", "  ")
+}
+
+func hashResources(res *resources) (string, error) {
+	hash := sha256.New()
+	marshal := proto.MarshalOptions{Deterministic: true}
+
+	for _, list := range [][]types.Resource{res.clusters, res.endpoints, res.routes, res.listeners} {
+		for _, r := range list {
+			b, err := marshal.Marshal(r)
+			if err != nil {
+				return "", err
+			}
+			hash.Write(b)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
@@ -0,0 +1,95 @@
+package xds
+
+import (
+	"github.com/ContainX/beethoven/config"
+	"github.com/ContainX/beethoven/scheduler"
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"testing"
+)
+
+func testApps() map[string]*scheduler.App {
+	return map[string]*scheduler.App{
+		"web": {
+			AppId:  "web",
+			Labels: map[string]string{scheduler.LabelVHost: "web.example.com, www.example.com", scheduler.LabelPortIndex: "1"},
+			Tasks: []scheduler.Task{
+				{Host: "10.0.0.1", Ports: []int{31000, 31001}},
+				{Host: "10.0.0.2", Ports: []int{31002}},
+			},
+		},
+		"api": {
+			AppId:  "api",
+			Labels: map[string]string{scheduler.LabelVHost: "web.example.com", scheduler.LabelPath: "/api"},
+			IpTasks: []scheduler.Task{
+				{Host: "192.168.0.3", Ports: []int{8080}, IpAddresses: []scheduler.IpAddress{{IpAddress: "192.168.0.3"}}},
+			},
+			IpPerTask: true,
+		},
+		"worker": {
+			AppId:  "worker",
+			Labels: map[string]string{},
+			Tasks:  []scheduler.Task{{Host: "10.0.0.4", Ports: []int{31004}}},
+		},
+	}
+}
+
+func newTestServer() *Server {
+	return New(&config.XdsConfig{ListenerAddress: "0.0.0.0", ListenerPort: 10000, ConnectTimeoutMs: 1000})
+}
+
+func TestBuildResources(t *testing.T) {
+	res, err := buildResources(newTestServer().cfg, testApps())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.clusters) != 3 || res.clusters[0].(*cluster.Cluster).Name != "api" {
+		t.Fatalf("Expected a cluster per app in order, got %d", len(res.clusters))
+	}
+
+	web := res.endpoints[1].(*endpoint.ClusterLoadAssignment)
+	lbs := web.Endpoints[0].LbEndpoints
+	if len(lbs) != 1 || lbs[0].GetEndpoint().GetAddress().GetSocketAddress().GetPortValue() != 31001 {
+		t.Errorf("Expected only tasks with the selected port index, got %v", lbs)
+	}
+
+	api := res.endpoints[0].(*endpoint.ClusterLoadAssignment)
+	if addr := api.Endpoints[0].LbEndpoints[0].GetEndpoint().GetAddress().GetSocketAddress().GetAddress(); addr != "192.168.0.3" {
+		t.Errorf("Expected task ip address for IP-per-task, got %s", addr)
+	}
+
+	rc := res.routes[0].(*route.RouteConfiguration)
+	if len(rc.VirtualHosts) != 2 {
+		t.Fatalf("Expected a virtual host per domain, got %d", len(rc.VirtualHosts))
+	}
+
+	routes := rc.VirtualHosts[0].Routes
+	if rc.VirtualHosts[0].Domains[0] != "web.example.com" || len(routes) != 2 || routes[0].GetMatch().GetPrefix() != "/api" {
+		t.Errorf("Expected longest prefix first, got %v", rc.VirtualHosts[0])
+	}
+}
+
+func TestUpdateOnlyPushesChanges(t *testing.T) {
+	s := newTestServer()
+	apps := testApps()
+
+	changed, err := s.Update(apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Expected first update to push a snapshot")
+	}
+
+	version := s.Version()
+	if changed, _ := s.Update(testApps()); changed {
+		t.Error("Expected identical apps not to push a snapshot")
+	}
+
+	apps["worker"].Tasks[0].Host = "10.0.0.5"
+	if changed, _ := s.Update(apps); !changed || s.Version() == version {
+		t.Error("Expected a changed task to push a new snapshot")
+	}
+}